@@ -120,7 +120,7 @@ func downloadPDFs(links []string, downloadFolder string) error {
 // Function to check if a file is an Arachnid result file
 func isArachnidResultFile(filename string) bool {
 	// Arachnid results typically end with _base.txt, _javascript.txt, _linkfinder.txt, etc.
-	patterns := []string{"_base.txt", "_javascript.txt", "_linkfinder.txt", "_form.txt", "_aws.txt", "_subdomain.txt"}
+	patterns := []string{"_base.txt", "_javascript.txt", "_linkfinder.txt", "_form.txt", "_aws.txt", "_cloud.txt", "_subdomain.txt"}
 	for _, pattern := range patterns {
 		if strings.HasSuffix(filename, pattern) {
 			return true
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBudgetSpent is the error of the requests dropped once the budget is spent
+var ErrBudgetSpent = errors.New("crawl budget spent")
+
+// Budget bounds the requests, time and bytes a crawl may spend.
+// Once the total budget is spent the crawl stops: queued requests are dropped
+// and the requests in flight end normally. A spent host budget only stops that host.
+type Budget struct {
+	MaxRequests        int
+	MaxRequestsPerHost int
+	MaxDuration        time.Duration
+	MaxBytes           int64
+
+	mu       sync.Mutex
+	start    time.Time
+	end      time.Time
+	requests int
+	perHost  map[string]int
+	bytes    int64
+	capped   map[string]bool
+	stopped  string
+	done     chan struct{}
+}
+
+// NewBudget creates the budget of the config, zero limits are unlimited
+func NewBudget(cfg *CrawlerConfig) *Budget {
+	return &Budget{
+		MaxRequests:        cfg.MaxRequests,
+		MaxRequestsPerHost: cfg.MaxRequestsPerHost,
+		MaxDuration:        cfg.MaxDuration,
+		MaxBytes:           cfg.MaxBytes,
+		perHost:            make(map[string]int),
+		capped:             make(map[string]bool),
+		done:               make(chan struct{}),
+	}
+}
+
+// Start starts the clock of MaxDuration
+func (b *Budget) Start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start = time.Now()
+}
+
+// End stops the clock of the crawl duration, only the first call counts
+func (b *Budget) End() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.end.IsZero() {
+		b.end = time.Now()
+	}
+}
+
+// Request spends a request on host, it returns false when no budget is left for it
+func (b *Budget) Request(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped != "" {
+		return false
+	}
+	if b.MaxDuration > 0 && !b.start.IsZero() && time.Since(b.start) >= b.MaxDuration {
+		b.stop(fmt.Sprintf("max duration of %s reached", b.MaxDuration))
+		return false
+	}
+	if b.MaxRequests > 0 && b.requests >= b.MaxRequests {
+		b.stop(fmt.Sprintf("max requests of %d reached", b.MaxRequests))
+		return false
+	}
+	if b.MaxRequestsPerHost > 0 && b.perHost[host] >= b.MaxRequestsPerHost {
+		if !b.capped[host] {
+			b.capped[host] = true
+			Logger.Warnf("Max requests of %d reached for %s", b.MaxRequestsPerHost, host)
+		}
+		return false
+	}
+	b.requests++
+	b.perHost[host]++
+	return true
+}
+
+// Download counts the bytes of a response
+func (b *Budget) Download(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytes += int64(n)
+	if b.MaxBytes > 0 && b.bytes >= b.MaxBytes && b.stopped == "" {
+		b.stop(fmt.Sprintf("max bytes of %d reached", b.MaxBytes))
+	}
+}
+
+// Stopped returns why the crawl was stopped, or an empty string
+func (b *Budget) Stopped() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopped
+}
+
+// Done is closed when the crawl is stopped
+func (b *Budget) Done() <-chan struct{} {
+	return b.done
+}
+
+// Stop stops the crawl before its budget is spent
+func (b *Budget) Stop(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped == "" {
+		b.stop(reason)
+	}
+}
+
+func (b *Budget) stop(reason string) {
+	b.stopped = reason
+	close(b.done)
+	Logger.Warnf("Stopping the crawl: %s", reason)
+}
+
+// Summary tells how much of the budget was spent
+func (b *Budget) Summary() CrawlSummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var hosts []string
+	for host := range b.capped {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	// The duration of a crawl still running is the time spent so far
+	var elapsed time.Duration
+	switch {
+	case b.start.IsZero():
+	case b.end.IsZero():
+		elapsed = time.Since(b.start)
+	default:
+		elapsed = b.end.Sub(b.start)
+	}
+	return CrawlSummary{
+		Requests:    b.requests,
+		Bytes:       b.bytes,
+		Duration:    elapsed,
+		StopReason:  b.stopped,
+		CappedHosts: hosts,
+	}
+}
+
+// budgetTransport spends the budget on the requests really sent,
+// the requests waiting for their turn in the collectors are not counted.
+type budgetTransport struct {
+	budget *Budget
+	next   http.RoundTripper
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.budget.Request(req.URL.Host) {
+		return nil, ErrBudgetSpent
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEndlessServer serves pages linking to the next pages forever
+func newEndlessServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/%d">a</a><a href="/%d">b</a>%s`, 2*n+1, 2*n+2, strings.Repeat("x", 1000))
+	}))
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(cfg *CrawlerConfig)
+		max    int32
+		reason string
+		capped bool
+	}{
+		{"requests", func(cfg *CrawlerConfig) { cfg.MaxRequests = 5 }, 5, "max requests of 5 reached", false},
+		{"per host", func(cfg *CrawlerConfig) { cfg.MaxRequestsPerHost = 4 }, 4, "", true},
+		{"bytes", func(cfg *CrawlerConfig) { cfg.MaxBytes = 3000; cfg.Concurrent = 1 }, 4, "max bytes of 3000 reached", false},
+		{"duration", func(cfg *CrawlerConfig) {
+			cfg.MaxDuration = 300 * time.Millisecond
+			cfg.Delay = 100 * time.Millisecond
+			cfg.Concurrent = 1
+		}, 5, "max duration of 300ms reached", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			ts := newEndlessServer(&requests)
+			defer ts.Close()
+			site, _ := url.Parse(ts.URL)
+
+			cfg := NewCrawlerConfig()
+			cfg.MaxDepth = 0
+			cfg.Robots = false
+			cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 1000))}
+			test.set(cfg)
+			crawler, err := NewCrawler(site, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crawler.Run()
+
+			if got := atomic.LoadInt32(&requests); got == 0 || got > test.max {
+				t.Errorf("got %d requests, want at most %d", got, test.max)
+			}
+			summary := crawler.Summary()
+			if summary.StopReason != test.reason {
+				t.Errorf("got stop reason %q, want %q", summary.StopReason, test.reason)
+			}
+			if capped := len(summary.CappedHosts) == 1 && summary.CappedHosts[0] == site.Host; capped != test.capped {
+				t.Errorf("unexpected capped hosts %v", summary.CappedHosts)
+			}
+		})
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	var requests int32
+	ts := newEndlessServer(&requests)
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.MaxDepth = 1
+	cfg.MaxResponseSize = 100
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	for out := range ch {
+		if out.OutputType == "url" && out.ContentLength > 100 {
+			t.Errorf("%s: response of %d bytes not truncated", out.Output, out.ContentLength)
+		}
+	}
+	if summary := crawler.Summary(); summary.Requests != 1 || summary.Bytes != 100 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestStop(t *testing.T) {
+	var requests int32
+	ts := newEndlessServer(&requests)
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 0
+	cfg.Robots = false
+	cfg.Concurrent = 1
+	cfg.Delay = 50 * time.Millisecond
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 1000))}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(200*time.Millisecond, crawler.Stop)
+	done := make(chan struct{})
+	go func() {
+		crawler.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawl not stopped")
+	}
+	// Closing again must be harmless
+	crawler.Close()
+
+	summary := crawler.Summary()
+	if summary.StopReason != "interrupted" || summary.Pages == 0 || summary.Found["url"] != summary.Pages {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	// The duration stops with the crawl
+	time.Sleep(20 * time.Millisecond)
+	if later := crawler.Summary(); later.Duration != summary.Duration {
+		t.Errorf("duration grew from %s to %s after the crawl", summary.Duration, later.Duration)
+	}
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Cloud storage providers
+const (
+	ProviderS3         = "aws-s3"
+	ProviderGCS        = "gcs"
+	ProviderAzureBlob  = "azure-blob"
+	ProviderDOSpaces   = "digitalocean-spaces"
+	ProviderFirebase   = "firebase"
+	ProviderCloudFront = "cloudfront"
+)
+
+// CloudAsset is a cloud storage bucket, database or distribution referenced by a response
+type CloudAsset struct {
+	Provider string `json:"provider"`
+	// Bucket is the name of the bucket, the Azure account/container,
+	// the Firebase database or the CloudFront distribution
+	Bucket string `json:"bucket"`
+	Region string `json:"region,omitempty"`
+	// URL is the canonical URL of the asset
+	URL string `json:"url"`
+}
+
+// cloudPattern finds the assets of a provider, asset returns false for the matches which aren't assets
+type cloudPattern struct {
+	re    *regexp.Regexp
+	asset func(m []string) (CloudAsset, bool)
+}
+
+var awsRegionRegex = regexp.MustCompile(`(?i)(?:us|eu|ap|sa|ca|me|af|il|mx|cn)(?:-gov|-iso[a-z]?)?-[a-z]+-[0-9]`)
+
+func s3Asset(bucket, endpoint string) (CloudAsset, bool) {
+	asset := CloudAsset{Provider: ProviderS3, Bucket: bucket, Region: awsRegionRegex.FindString(endpoint)}
+	if asset.Region != "" {
+		asset.URL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, asset.Region)
+	} else {
+		asset.URL = fmt.Sprintf("https://%s.s3.amazonaws.com", bucket)
+	}
+	return asset, true
+}
+
+func gcsAsset(bucket string) (CloudAsset, bool) {
+	switch bucket {
+	case "download", "upload", "storage":
+		// Paths of the JSON API, not buckets
+		return CloudAsset{}, false
+	}
+	return CloudAsset{Provider: ProviderGCS, Bucket: bucket, URL: "https://storage.googleapis.com/" + bucket}, true
+}
+
+// The patterns are case insensitive, a leading (?:^|[^a-z0-9.-]) makes sure a path style host isn't a subdomain
+var cloudPatterns = []cloudPattern{
+	// S3 virtual hosted style, with or without region, website and dualstack endpoints
+	{regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])\.(s3(?:[.-][a-z0-9-]+)*)\.amazonaws\.com(?:\.cn)?\b`),
+		func(m []string) (CloudAsset, bool) { return s3Asset(m[1], m[2]) }},
+	// S3 path style
+	{regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])(s3(?:[.-][a-z0-9-]+)*)\.amazonaws\.com(?:\.cn)?/([a-z0-9][a-z0-9._-]{1,61}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return s3Asset(m[2], m[1]) }},
+	// S3 URIs and ARNs
+	{regexp.MustCompile(`(?i)(?:\bs3://|\barn:aws[a-z-]*:s3:::)([a-z0-9][a-z0-9.-]{1,61}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return s3Asset(m[1], "") }},
+
+	// GCS JSON API, path style, virtual hosted style, gs:// URIs and Firebase storage
+	{regexp.MustCompile(`(?i)googleapis\.com/(?:download/|upload/)?storage/v1/b/([a-z0-9][a-z0-9._-]{1,220}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return gcsAsset(m[1]) }},
+	{regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])(?:storage\.googleapis\.com|storage\.cloud\.google\.com|commondatastorage\.googleapis\.com)/([a-z0-9][a-z0-9._-]{1,220}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return gcsAsset(m[1]) }},
+	{regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9._-]{1,220}[a-z0-9])\.storage\.googleapis\.com`),
+		func(m []string) (CloudAsset, bool) { return gcsAsset(m[1]) }},
+	{regexp.MustCompile(`(?i)(?:\bgs://|firebasestorage\.googleapis\.com/v0/b/)([a-z0-9][a-z0-9._-]{1,220}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return gcsAsset(m[1]) }},
+	{regexp.MustCompile(`(?i)storageBucket['"]?\s*[:=]\s*['"]([a-z0-9][a-z0-9._-]{1,220}[a-z0-9])['"]`),
+		func(m []string) (CloudAsset, bool) { return gcsAsset(m[1]) }},
+
+	// Azure Blob storage account, with its container when in the URL
+	{regexp.MustCompile(`(?i)\b([a-z0-9]{3,24})\.blob\.core\.windows\.net(?:/([a-z0-9](?:[a-z0-9-]{1,61}[a-z0-9])?|\$root|\$web)\b)?`),
+		func(m []string) (CloudAsset, bool) {
+			asset := CloudAsset{Provider: ProviderAzureBlob, Bucket: m[1], URL: fmt.Sprintf("https://%s.blob.core.windows.net", m[1])}
+			if m[2] != "" {
+				asset.Bucket += "/" + m[2]
+				asset.URL += "/" + m[2]
+			}
+			return asset, true
+		}},
+
+	// DigitalOcean Spaces, virtual hosted and path styles, CDN included
+	{regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9-]{1,61}[a-z0-9])\.([a-z]{3}[0-9])\.(?:cdn\.)?digitaloceanspaces\.com`),
+		func(m []string) (CloudAsset, bool) { return doSpacesAsset(m[1], m[2]) }},
+	{regexp.MustCompile(`(?i)(?:^|[^a-z0-9.-])([a-z]{3}[0-9])\.digitaloceanspaces\.com/([a-z0-9][a-z0-9-]{1,61}[a-z0-9])`),
+		func(m []string) (CloudAsset, bool) { return doSpacesAsset(m[2], m[1]) }},
+
+	// Firebase Realtime Database, the legacy and the regional hosts
+	{regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9-]{0,61}[a-z0-9])\.firebaseio\.com`),
+		func(m []string) (CloudAsset, bool) {
+			return CloudAsset{Provider: ProviderFirebase, Bucket: m[1], URL: fmt.Sprintf("https://%s.firebaseio.com", m[1])}, true
+		}},
+	{regexp.MustCompile(`(?i)\b([a-z0-9][a-z0-9-]{0,61}[a-z0-9])\.([a-z]+-[a-z]+[0-9])\.firebasedatabase\.app`),
+		func(m []string) (CloudAsset, bool) {
+			return CloudAsset{Provider: ProviderFirebase, Bucket: m[1], Region: m[2], URL: fmt.Sprintf("https://%s.%s.firebasedatabase.app", m[1], m[2])}, true
+		}},
+
+	// CloudFront distribution
+	{regexp.MustCompile(`(?i)\b([a-z0-9]{8,20})\.cloudfront\.net`),
+		func(m []string) (CloudAsset, bool) {
+			return CloudAsset{Provider: ProviderCloudFront, Bucket: m[1], URL: fmt.Sprintf("https://%s.cloudfront.net", m[1])}, true
+		}},
+}
+
+func doSpacesAsset(bucket, region string) (CloudAsset, bool) {
+	return CloudAsset{
+		Provider: ProviderDOSpaces,
+		Bucket:   bucket,
+		Region:   region,
+		URL:      fmt.Sprintf("https://%s.%s.digitaloceanspaces.com", bucket, region),
+	}, true
+}
+
+// The slashes of the URLs in JSON strings are often escaped
+var escapedSlashReplacer = strings.NewReplacer(`\/`, "/", `\u002f`, "/", `\u002F`, "/")
+
+// GetCloudAssets returns the cloud storage buckets, databases and distributions referenced by source, once each
+func GetCloudAssets(source string) []CloudAsset {
+	source = escapedSlashReplacer.Replace(source)
+	var assets []CloudAsset
+	seen := make(map[string]bool)
+	for _, pattern := range cloudPatterns {
+		for _, m := range pattern.re.FindAllStringSubmatch(source, -1) {
+			for i := range m {
+				m[i] = strings.ToLower(m[i])
+			}
+			asset, ok := pattern.asset(m)
+			if !ok || seen[asset.URL] {
+				continue
+			}
+			seen[asset.URL] = true
+			assets = append(assets, asset)
+		}
+	}
+	return assets
+}
+
+// findCloudAssets reports the cloud storage assets of a response.
+// The S3 buckets keep their aws output, written to <domain>_aws.txt.
+func (crawler *Crawler) findCloudAssets(source string, from string) {
+	for _, asset := range GetCloudAssets(source) {
+		asset := asset
+		outputType := "cloud"
+		if asset.Provider == ProviderS3 {
+			outputType = "aws"
+		}
+		if !crawler.cloudSet.Duplicate(asset.URL) {
+			crawler.emit(SpiderOutput{
+				Source:     from,
+				OutputType: outputType,
+				Output:     asset.URL,
+				Cloud:      &asset,
+			})
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGetCloudAssets(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []CloudAsset
+	}{
+		{`<img src="https://assets.s3.amazonaws.com/logo.png">`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "assets", URL: "https://assets.s3.amazonaws.com"}}},
+		{`https://my-bucket.s3.eu-west-3.amazonaws.com/a.js`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "my-bucket", Region: "eu-west-3", URL: "https://my-bucket.s3.eu-west-3.amazonaws.com"}}},
+		{`//logs.example.com.s3-us-west-2.amazonaws.com/x`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "logs.example.com", Region: "us-west-2", URL: "https://logs.example.com.s3.us-west-2.amazonaws.com"}}},
+		{`http://site.s3-website-ap-southeast-1.amazonaws.com`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "site", Region: "ap-southeast-1", URL: "https://site.s3.ap-southeast-1.amazonaws.com"}}},
+		{`"https:\/\/s3.us-east-2.amazonaws.com\/Backups\/db.sql"`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "backups", Region: "us-east-2", URL: "https://backups.s3.us-east-2.amazonaws.com"}}},
+		{`https://s3-eu-central-1.amazonaws.com/uploads/a.png`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "uploads", Region: "eu-central-1", URL: "https://uploads.s3.eu-central-1.amazonaws.com"}}},
+		{`s3://data-lake/raw and arn:aws:s3:::audit-logs/*`, []CloudAsset{
+			{Provider: ProviderS3, Bucket: "data-lake", URL: "https://data-lake.s3.amazonaws.com"},
+			{Provider: ProviderS3, Bucket: "audit-logs", URL: "https://audit-logs.s3.amazonaws.com"}}},
+
+		{`https://storage.googleapis.com/media-prod/v.mp4 gs://exports`, []CloudAsset{
+			{Provider: ProviderGCS, Bucket: "media-prod", URL: "https://storage.googleapis.com/media-prod"},
+			{Provider: ProviderGCS, Bucket: "exports", URL: "https://storage.googleapis.com/exports"}}},
+		{`https://static.storage.googleapis.com/a.css`, []CloudAsset{
+			{Provider: ProviderGCS, Bucket: "static", URL: "https://storage.googleapis.com/static"}}},
+		{`https://storage.googleapis.com/download/storage/v1/b/reports/o/a.pdf`, []CloudAsset{
+			{Provider: ProviderGCS, Bucket: "reports", URL: "https://storage.googleapis.com/reports"}}},
+		{`storageBucket: "my-app.appspot.com", databaseURL: "https://my-app-default-rtdb.firebaseio.com"`, []CloudAsset{
+			{Provider: ProviderGCS, Bucket: "my-app.appspot.com", URL: "https://storage.googleapis.com/my-app.appspot.com"},
+			{Provider: ProviderFirebase, Bucket: "my-app-default-rtdb", URL: "https://my-app-default-rtdb.firebaseio.com"}}},
+		{`https://chat-1.europe-west1.firebasedatabase.app/.json`, []CloudAsset{
+			{Provider: ProviderFirebase, Bucket: "chat-1", Region: "europe-west1", URL: "https://chat-1.europe-west1.firebasedatabase.app"}}},
+
+		{`https://acmeprod.blob.core.windows.net/invoices/2021.pdf https://acmedev.blob.core.windows.net`, []CloudAsset{
+			{Provider: ProviderAzureBlob, Bucket: "acmeprod/invoices", URL: "https://acmeprod.blob.core.windows.net/invoices"},
+			{Provider: ProviderAzureBlob, Bucket: "acmedev", URL: "https://acmedev.blob.core.windows.net"}}},
+		{`https://files.nyc3.digitaloceanspaces.com/a https://ams3.digitaloceanspaces.com/backups/b https://cdn-assets.fra1.cdn.digitaloceanspaces.com`, []CloudAsset{
+			{Provider: ProviderDOSpaces, Bucket: "files", Region: "nyc3", URL: "https://files.nyc3.digitaloceanspaces.com"},
+			{Provider: ProviderDOSpaces, Bucket: "cdn-assets", Region: "fra1", URL: "https://cdn-assets.fra1.digitaloceanspaces.com"},
+			{Provider: ProviderDOSpaces, Bucket: "backups", Region: "ams3", URL: "https://backups.ams3.digitaloceanspaces.com"}}},
+		{`<script src="https://d111111abcdef8.cloudfront.net/app.js"></script>`, []CloudAsset{
+			{Provider: ProviderCloudFront, Bucket: "d111111abcdef8", URL: "https://d111111abcdef8.cloudfront.net"}}},
+
+		{`https://example.com/s3/amazonaws and https://www.google.com/storage`, nil},
+	}
+	for _, tt := range tests {
+		if got := GetCloudAssets(tt.source); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetCloudAssets(%q) =\n%+v, want\n%+v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestAWSS3Regions(t *testing.T) {
+	// The region of the s3- hostnames used to match a single character only
+	got := GetAWSS3(`https://bucket.s3-eu-west-1.amazonaws.com/a`)
+	if len(got) != 1 || got[0] != "bucket.s3-eu-west-1.amazonaws.com" {
+		t.Errorf("unexpected matches %v", got)
+	}
+}
+
+func TestCrawlerCloudAssets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<img src="https://assets.s3.amazonaws.com/logo.png"><img src="https://storage.googleapis.com/media/a.png">`))
+	}))
+	defer ts.Close()
+
+	site, _ := url.Parse(ts.URL)
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]string)
+	for out := range ch {
+		if out.Cloud != nil {
+			found[out.Output] = out.OutputType
+		}
+	}
+	// The S3 buckets are still written to <domain>_aws.txt
+	want := map[string]string{
+		"https://assets.s3.amazonaws.com":      "aws",
+		"https://storage.googleapis.com/media": "cloud",
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got cloud assets %v, want %v", found, want)
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"time"
+)
+
+// CrawlerConfig holds every option used to build a Crawler.
+// It is filled from CLI flags by the arachnid command, but can be built directly
+// when the crawler is embedded as a library.
+type CrawlerConfig struct {
+	// Crawling
+	MaxDepth    int
+	Concurrent  int
+	Delay       time.Duration
+	RandomDelay time.Duration
+	Timeout     time.Duration
+	NoRedirect  bool
+	// Polite follows the robots.txt rules of the site and its Crawl-delay
+	Polite bool
+	// HostLimits override Concurrent, Delay and RandomDelay for some hosts,
+	// the first one matching a host applies
+	HostLimits []HostLimit
+	// AdaptiveRate slows down on the hosts answering 429 or 503, or much slower than usual,
+	// and queues the throttled requests again
+	AdaptiveRate bool
+
+	// Budget of the crawl, zero means unlimited.
+	// MaxResponseSize truncates the bodies, colly's 10MB default is kept when zero.
+	MaxRequests        int
+	MaxRequestsPerHost int
+	MaxDuration        time.Duration
+	MaxBytes           int64
+	MaxResponseSize    int
+
+	// SubmitForms fills the discovered forms with dummy values and crawls the result.
+	// Only GET forms are submitted unless SubmitPost is set.
+	SubmitForms bool
+	SubmitPost  bool
+
+	// Scope
+	Subs            bool
+	Blacklist       string
+	Whitelist       string
+	WhitelistDomain string
+	// ScopeRules are added after the rules of the site and whitelists, before the blacklist
+	ScopeRules []ScopeRule
+
+	// Request
+	Proxy     string
+	UserAgent string
+	Cookie    string
+	Headers   []string
+	BurpFile  string
+
+	// Proxies are used in turn with Proxy, picked by ProxyRotation:
+	// ProxyRoundRobin (the default) or ProxyPerHost.
+	// ProxyAuth is the user:password of the proxies given without one, SOCKS5 ones included.
+	Proxies       []string
+	ProxyRotation string
+	ProxyAuth     string
+
+	// Output
+	OutputFolder string
+	Quiet        bool
+	JsonOutput   bool
+	Length       bool
+	Raw          bool
+	FilterLength []int
+
+	// Sinks receive every finding. When empty, results are printed to stdout
+	// as text or JSON depending on JsonOutput.
+	Sinks []ResultSink
+
+	// StateDir enables saving the crawl progress in this folder.
+	// With Resume, a previous crawl of the same site continues where it stopped.
+	StateDir string
+	Resume   bool
+
+	// Render pages with a headless Chromium to find the URLs of JavaScript applications.
+	// Renderer overrides the default Chromium renderer.
+	Render     bool
+	RenderWait time.Duration
+	ChromePath string
+	Renderer   Renderer
+
+	// Secrets scans the in-scope responses and scripts for API keys, tokens and credentials.
+	// SecretRules are added to the default rules, replacing the ones with the same ID.
+	Secrets     bool
+	SecretRules []SecretRule
+
+	// Fingerprint detects the technologies of the in-scope responses, with their versions.
+	// Fingerprinter overrides the default Wappalyzer rules.
+	Fingerprint   bool
+	Fingerprinter *Fingerprinter
+
+	// Sources
+	LinkFinder               bool
+	Sitemap                  bool
+	Robots                   bool
+	OtherSource              bool
+	IncludeSubs              bool
+	IncludeOtherSourceResult bool
+
+	// SitemapDepth is how many levels of sitemap indexes are followed with Sitemap
+	SitemapDepth int
+
+	// Sources are the names of the passive providers used with OtherSource, all of them when empty.
+	// SourcesConfig holds their API keys, Providers overrides them entirely.
+	Sources       []string
+	SourcesConfig map[string]ProviderConfig
+	Providers     []Provider
+}
+
+// NewCrawlerConfig returns a CrawlerConfig with the same defaults as the CLI.
+func NewCrawlerConfig() *CrawlerConfig {
+	return &CrawlerConfig{
+		MaxDepth:     1,
+		Concurrent:   5,
+		Timeout:      10 * time.Second,
+		UserAgent:    "web",
+		LinkFinder:   true,
+		SitemapDepth: DefaultSitemapDepth,
+		Robots:       true,
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"bufio"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,17 +11,15 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
-	"strconv"
-
-	jsoniter "github.com/json-iterator/go"
 
 	"github.com/gocolly/colly/v2"
 	"github.com/gocolly/colly/v2/extensions"
 	"github.com/jaeles-project/gospider/stringset"
-	"github.com/spf13/cobra"
 )
 
+// DefaultHTTPTransport is the template of the transport of each crawler, it is never used directly
 var DefaultHTTPTransport = &http.Transport{
 	DialContext: (&net.Dialer{
 		Timeout: 10 * time.Second,
@@ -38,30 +37,67 @@ var DefaultHTTPTransport = &http.Transport{
 }
 
 type Crawler struct {
-	cmd                 *cobra.Command
+	config              *CrawlerConfig
 	C                   *colly.Collector
 	LinkFinderCollector *colly.Collector
-	Output              *Output
+	sinks               []ResultSink
+	client              *http.Client
+	transport           *http.Transport
+	headers             map[string]string
+	scope               *Scope
+	budget              *Budget
+	limiter             *HostLimiter
+	stats               crawlStats
+	secrets             *SecretScanner
+	fingerprinter       *Fingerprinter
+	closeOnce           sync.Once
+	robotsOnce          sync.Once
+	robotsBody          []byte
+	robotsGroup         *RobotsGroup
+	state               *State
+	renderer            Renderer
+	ownRenderer         bool
+
+	subSet    stringFilter
+	cloudSet  stringFilter
+	jsSet     stringFilter
+	urlSet    stringFilter
+	formSet   stringFilter
+	secretSet stringFilter
+	techSet   stringFilter
+
+	// output is the output folder, nil when the results are not saved
+	output *Output
+
+	// visits hands the URLs found by the link finder and the renders over to C
+	visits chan queuedVisit
+	// renders are the renders running or waiting for a tab
+	renders sync.WaitGroup
+
+	site   *url.URL
+	domain string
+	Input  string
+	raw    bool
 
-	subSet  *stringset.StringFilter
-	awsSet  *stringset.StringFilter
-	jsSet   *stringset.StringFilter
-	urlSet  *stringset.StringFilter
-	formSet *stringset.StringFilter
 
-	site       *url.URL
-	domain     string
-	Input      string
-	Quiet      bool
-	JsonOutput bool
-	length     bool
-	raw        bool
-	subs       bool
+	filterLength_slice		[]int
 
 
-	filterLength_slice		[]int
+}
 
+// stringFilter dedupes the findings of a crawler
+type stringFilter interface {
+	Duplicate(s string) bool
+}
 
+// exactFilter is a stringFilter keeping the case of the strings, the StringFilter lowercases them
+type exactFilter struct {
+	seen sync.Map
+}
+
+func (f *exactFilter) Duplicate(s string) bool {
+	_, loaded := f.seen.LoadOrStore(s, struct{}{})
+	return loaded
 }
 
 type SpiderOutput struct {
@@ -69,68 +105,76 @@ type SpiderOutput struct {
 	Source     string `json:"source"`
 	OutputType string `json:"type"`
 	Output     string `json:"output"`
+	Method     string `json:"method,omitempty"`
 	StatusCode int    `json:"status"`
 	Length     int    `json:"length"`
+	Form       *Form  `json:"form,omitempty"`
+	// Timestamp is when a 3rd party source captured the URL
+	Timestamp string `json:"timestamp,omitempty"`
+	// LastMod and Priority come from the sitemap entry of the URL
+	LastMod  string `json:"lastmod,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	// Robots is the robots.txt rule the URL comes from
+	Robots *RobotsRule `json:"robots,omitempty"`
+	// Secret is the secret found, with the rule which found it and its context
+	Secret *Secret `json:"secret,omitempty"`
+	// Technology is the technology detected, with its version and categories
+	Technology *Technology `json:"technology,omitempty"`
+	// Cloud is the cloud storage asset found
+	Cloud *CloudAsset `json:"cloud,omitempty"`
+
+	// ContentLength is the response body size, only shown in text output with --length
+	ContentLength int `json:"-"`
 }
 
-func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
+func NewCrawler(site *url.URL, cfg *CrawlerConfig) (*Crawler, error) {
 	domain := GetDomain(site)
 	if domain == "" {
-		Logger.Error("Failed to parse domain")
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to parse domain from %s", site)
 	}
 	Logger.Infof("Start crawling: %s", site)
 
-	quiet, _ := cmd.Flags().GetBool("quiet")
-	jsonOutput, _ := cmd.Flags().GetBool("json")
-	maxDepth, _ := cmd.Flags().GetInt("depth")
-	concurrent, _ := cmd.Flags().GetInt("concurrent")
-	delay, _ := cmd.Flags().GetInt("delay")
-	randomDelay, _ := cmd.Flags().GetInt("random-delay")
-	length, _ := cmd.Flags().GetBool("length")
-	raw, _ := cmd.Flags().GetBool("raw")
-	subs, _ := cmd.Flags().GetBool("subs")
-
 	c := colly.NewCollector(
 		colly.Async(true),
-		colly.MaxDepth(maxDepth),
+		colly.MaxDepth(cfg.MaxDepth),
 		colly.IgnoreRobotsTxt(),
 	)
 
+	scope, err := NewScope(site, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Setup http client
 	client := &http.Client{}
 
-	// Set proxy
-	proxy, _ := cmd.Flags().GetString("proxy")
-	if proxy != "" {
-		Logger.Infof("Proxy: %s", proxy)
-		pU, err := url.Parse(proxy)
-		if err != nil {
-			Logger.Error("Failed to set proxy")
-		} else {
-			DefaultHTTPTransport.Proxy = http.ProxyURL(pU)
-		}
+	// Each crawler has its own transport and proxies
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Proxy != "" {
+		Logger.Infof("Proxy: %s", cfg.Proxy)
+	}
+	if len(cfg.Proxies) > 0 {
+		Logger.Infof("Proxy list: %d proxies", len(cfg.Proxies))
 	}
 
 	// Set request timeout
-	timeout, _ := cmd.Flags().GetInt("timeout")
-	if timeout == 0 {
+	if cfg.Timeout == 0 {
 		Logger.Info("Your input timeout is 0. Gospider will set it to 10 seconds")
 		client.Timeout = 10 * time.Second
 	} else {
-		client.Timeout = time.Duration(timeout) * time.Second
+		client.Timeout = cfg.Timeout
 	}
 
 	// Disable redirect
-	noRedirect, _ := cmd.Flags().GetBool("no-redirect")
-	if noRedirect {
+	if cfg.NoRedirect {
 		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 			nextLocation := req.Response.Header.Get("Location")
 			Logger.Debugf("Found Redirect: %s", nextLocation)
-			// Allow in redirect from http to https or in same hostname
-			// We just check contain hostname or not because we set URLFilter in main collector so if
-			// the URL is https://otherdomain.com/?url=maindomain.com, it will reject it
-			if strings.Contains(nextLocation, site.Hostname()) {
+			// Only follow the redirects staying in scope, like from http to https
+			if scope.InScope(req.URL) {
 				Logger.Infof("Redirecting to: %s", nextLocation)
 				return nil
 			}
@@ -138,12 +182,17 @@ func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
 		}
 	}
 
+	if cfg.MaxResponseSize > 0 {
+		c.MaxBodySize = cfg.MaxResponseSize
+	}
+
 	// Set client transport
-	client.Transport = DefaultHTTPTransport
+	budget := NewBudget(cfg)
+	client.Transport = &budgetTransport{budget: budget, next: transport}
 	c.SetClient(client)
 
 	// Get headers here to overwrite if "burp" flag used
-	burpFile, _ := cmd.Flags().GetString("burp")
+	burpFile := cfg.BurpFile
 	if burpFile != "" {
 		bF, err := os.Open(burpFile)
 		if err != nil {
@@ -171,7 +220,7 @@ func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
 	}
 
 	// Set cookies
-	cookie, _ := cmd.Flags().GetString("cookie")
+	cookie := cfg.Cookie
 	if cookie != "" && burpFile == "" {
 		c.OnRequest(func(r *colly.Request) {
 			r.Headers.Set("Cookie", cookie)
@@ -179,10 +228,13 @@ func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
 	}
 
 	// Set headers
-	headers, _ := cmd.Flags().GetStringArray("header")
 	if burpFile == "" {
-		for _, h := range headers {
+		for _, h := range cfg.Headers {
 			headerArgs := strings.SplitN(h, ":", 2)
+			if len(headerArgs) != 2 {
+				Logger.Errorf("Invalid header: %s", h)
+				continue
+			}
 			headerKey := strings.TrimSpace(headerArgs[0])
 			headerValue := strings.TrimSpace(headerArgs[1])
 			c.OnRequest(func(r *colly.Request) {
@@ -192,11 +244,10 @@ func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
 	}
 
 	// Set User-Agent
-	randomUA, _ := cmd.Flags().GetString("user-agent")
-	switch ua := strings.ToLower(randomUA); {
+	switch ua := strings.ToLower(cfg.UserAgent); {
 	case ua == "mobi":
 		extensions.RandomMobileUserAgent(c)
-	case ua == "web":
+	case ua == "web" || ua == "":
 		extensions.RandomUserAgent(c)
 	default:
 		c.UserAgent = ua
@@ -205,143 +256,514 @@ func NewCrawler(site *url.URL, cmd *cobra.Command) *Crawler {
 	// Set referer
 	extensions.Referer(c)
 
-	// Init Output
+	// The output files and the state opened below are closed again when the crawler can't be created,
+	// the lock of the state file would block the next crawl of the site
 	var output *Output
-	outputFolder, _ := cmd.Flags().GetString("output")
-	if outputFolder != "" {
-		filename := strings.ReplaceAll(site.Hostname(), ".", "_")
-		output = NewOutput(outputFolder, filename)
+	var state *State
+	created := false
+	defer func() {
+		if created {
+			return
+		}
+		if output != nil {
+			output.Close()
+		}
+		if state != nil {
+			state.Close()
+		}
+	}()
+
+	// Init Output
+	sinks := cfg.Sinks
+	if len(sinks) == 0 {
+		if cfg.JsonOutput {
+			sinks = append(sinks, NewJSONSink(os.Stdout))
+		} else {
+			sinks = append(sinks, NewTextSink(os.Stdout, cfg.Quiet, cfg.Length))
+		}
+	}
+	if cfg.OutputFolder != "" {
+		output, err = NewOutput(cfg.OutputFolder, site.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, NewFileSink(output, cfg.JsonOutput, cfg.Length))
 	}
 
-	// Init Length Filter
-    filterLength_slice := []int{}
-	filterLength, _ := cmd.Flags().GetString("filter-length")
+	// GoSpider default disallowed regex
+	disallowedRegex := `(?i)\.(png|apng|bmp|gif|ico|cur|jpg|jpeg|jfif|pjp|pjpeg|svg|tif|tiff|webp|xbm|3gp|aac|flac|mpg|mpeg|mp3|mp4|m4a|m4v|m4p|oga|ogg|ogv|mov|wav|webm|eot|woff|woff2|ttf|otf|css)(?:\?|#|$)`
+	c.DisallowedURLFilters = append(c.DisallowedURLFilters, regexp.MustCompile(disallowedRegex))
 
-	if filterLength != "" {
+	var secrets *SecretScanner
+	if cfg.Secrets {
+		secrets, err = NewSecretScanner(cfg.SecretRules)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		lengthArgs := strings.Split(filterLength, ",")
-		for i:=0; i < len(lengthArgs);i++ {
-			if i, err := strconv.Atoi(lengthArgs[i]); err == nil {
-				filterLength_slice = append(filterLength_slice,i)
-			}
+	var fingerprinter *Fingerprinter
+	if cfg.Fingerprint {
+		fingerprinter = cfg.Fingerprinter
+		if fingerprinter == nil {
+			fingerprinter = DefaultFingerprinter()
+		}
+	}
+
+	// Persist the crawl progress, the storage must be set before cloning the collector
+	if cfg.StateDir != "" {
+		state, err = OpenState(cfg.StateDir, site, cfg.Resume)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.SetStorage(state); err != nil {
+			return nil, fmt.Errorf("failed to set state storage: %s", err)
+		}
+	}
+	newFilter := func(name string) stringFilter {
+		if state == nil {
+			return stringset.NewStringFilter()
+		}
+		f, err := state.Filter(name)
+		if err != nil {
+			Logger.Errorf("Failed to load %s set from state: %s", name, err)
+		}
+		return f
+	}
+	// Secrets differing only by case are different secrets
+	newExactFilter := func(name string) stringFilter {
+		if state == nil {
+			return &exactFilter{}
+		}
+		f, err := state.ExactFilter(name)
+		if err != nil {
+			Logger.Errorf("Failed to load %s set from state: %s", name, err)
 		}
+		return f
 	}
 
-	// Set url whitelist regex
-	reg :=""
-	if subs {
-		reg = site.Hostname()
-	}else {
-		reg ="(?:https|http)://"+site.Hostname()
+	// Headers of the requests sent outside of the collectors
+	headers := make(map[string]string)
+	if ua := strings.ToLower(cfg.UserAgent); ua != "" && ua != "web" && ua != "mobi" {
+		headers["User-Agent"] = c.UserAgent
+	}
+	if cfg.Cookie != "" {
+		headers["Cookie"] = cfg.Cookie
+	}
+	for _, h := range cfg.Headers {
+		if headerArgs := strings.SplitN(h, ":", 2); len(headerArgs) == 2 {
+			headers[strings.TrimSpace(headerArgs[0])] = strings.TrimSpace(headerArgs[1])
+		}
 	}
 
-	sRegex := regexp.MustCompile(reg) 
-	c.URLFilters = append(c.URLFilters, sRegex)
+	// Setup the headless browser
+	renderer, ownRenderer := cfg.Renderer, false
+	if renderer == nil && cfg.Render {
+		renderer, err = NewChromeRenderer(RenderOptions{
+			ExecPath: cfg.ChromePath,
+			Proxy:    renderProxy(cfg),
+			Headers:  headers,
+			Timeout:  cfg.Timeout,
+			Wait:     cfg.RenderWait,
+			Allow:    renderAllow(scope, budget),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ownRenderer = true
+	}
+
+	// The result of link finder will be send to Link Finder Collector to check is it working or not.
+	linkFinderCollector := c.Clone()
+
+	crawler := &Crawler{
+		config:              cfg,
+		C:                   c,
+		LinkFinderCollector: linkFinderCollector,
+		sinks:               sinks,
+		client:              client,
+		transport:           transport,
+		headers:             headers,
+		scope:               scope,
+		budget:              budget,
+		state:               state,
+		renderer:            renderer,
+		ownRenderer:         ownRenderer,
+		secrets:             secrets,
+		fingerprinter:       fingerprinter,
+		output:              output,
+		site:                site,
+		Input:               site.String(),
+		raw:                 cfg.Raw,
+		domain:              domain,
+		urlSet:              newFilter("url"),
+		subSet:              newFilter("sub"),
+		jsSet:               newFilter("js"),
+		formSet:             newFilter("form"),
+		secretSet:           newExactFilter("secret"),
+		cloudSet:            newFilter("cloud"),
+		techSet:             newFilter("technology"),
+		filterLength_slice:  cfg.FilterLength,
+		visits:              make(chan queuedVisit, visitQueueSize),
+	}
+	// From here Close releases them
+	created = true
+	// The limits are set by Run, robots.txt is not downloaded before the crawl
+	for _, limit := range cfg.HostLimits {
+		if err := limit.validate(); err != nil {
+			crawler.Close()
+			return nil, err
+		}
+	}
+	if cfg.AdaptiveRate {
+		crawler.limiter = NewHostLimiter(crawler.client.Transport)
+		crawler.client.Transport = crawler.limiter
+	}
+	crawler.setupScope()
+	crawler.setupBudget()
+	crawler.setupSourceSlots()
+	crawler.setupVisits()
+	if state != nil {
+		crawler.setupState()
+	}
+	// Retries come after the state so a retried request stays in the frontier
+	if crawler.limiter != nil {
+		crawler.setupRetry()
+	}
+	return crawler, nil
+}
+
+// setupLimits sets the concurrency and delay of the requests, HostLimits override them for some hosts.
+// In polite mode the Crawl-delay of robots.txt applies to the site when it is longer.
+func (crawler *Crawler) setupLimits() error {
+	cfg := crawler.config
+	var crawlDelay time.Duration
+	if cfg.Polite {
+		crawlDelay = crawler.setupPolite()
+	}
+
+	// The first matching rule applies, the host limits come first
+	for _, limit := range cfg.HostLimits {
+		rule := limit.limitRule()
+		if rule.Parallelism == 0 {
+			rule.Parallelism = cfg.Concurrent
+		}
+		// Init compiles the glob for Match, the rule is final before colly uses it
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("failed to set Limit Rule of %s: %s", limit.Host, err)
+		}
+		// robots.txt still has the last word on the site
+		if rule.Match(crawler.site.Host) && rule.Delay < crawlDelay {
+			Logger.Infof("Using the Crawl-delay of robots.txt for %s: %s", limit.Host, crawlDelay)
+			rule.Delay = crawlDelay
+		}
+		if err := crawler.C.Limit(rule); err != nil {
+			return fmt.Errorf("failed to set Limit Rule of %s: %s", limit.Host, err)
+		}
+	}
+
+	if crawlDelay > cfg.Delay {
+		Logger.Infof("Using the Crawl-delay of robots.txt: %s", crawlDelay)
+		err := crawler.C.Limit(&colly.LimitRule{
+			DomainRegexp: "^" + regexp.QuoteMeta(crawler.site.Host) + "$",
+			Parallelism:  cfg.Concurrent,
+			Delay:        crawlDelay,
+			RandomDelay:  cfg.RandomDelay,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set Limit Rule: %s", err)
+		}
+	}
 
 	// Set Limit Rule
-	err := c.Limit(&colly.LimitRule{
+	err := crawler.C.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
-		Parallelism: concurrent,
-		Delay:       time.Duration(delay) * time.Second,
-		RandomDelay: time.Duration(randomDelay) * time.Second,
+		Parallelism: cfg.Concurrent,
+		Delay:       cfg.Delay,
+		RandomDelay: cfg.RandomDelay,
 	})
 	if err != nil {
-		Logger.Errorf("Failed to set Limit Rule: %s", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to set Limit Rule: %s", err)
 	}
+	return nil
+}
 
-	// GoSpider default disallowed regex
-	disallowedRegex := `(?i)\.(png|apng|bmp|gif|ico|cur|jpg|jpeg|jfif|pjp|pjpeg|svg|tif|tiff|webp|xbm|3gp|aac|flac|mpg|mpeg|mp3|mp4|m4a|m4v|m4p|oga|ogg|ogv|mov|wav|webm|eot|woff|woff2|ttf|otf|css)(?:\?|#|$)`
-	c.DisallowedURLFilters = append(c.DisallowedURLFilters, regexp.MustCompile(disallowedRegex))
+// setupScope drops the requests queued in the collectors once the crawl is stopped.
+// The URLs out of the scope or disallowed by robots.txt are checked before being visited,
+// colly would mark them as visited otherwise.
+func (crawler *Crawler) setupScope() {
+	for _, c := range []*colly.Collector{crawler.C, crawler.LinkFinderCollector} {
+		c := c
+		c.OnRequest(func(r *colly.Request) {
+			if !crawler.allowed(c, r.URL) {
+				r.Abort()
+			}
+		})
+	}
+}
+
+// setupBudget counts the bytes downloaded by the collectors, and their pages and errors for the summary
+func (crawler *Crawler) setupBudget() {
+	for _, c := range []*colly.Collector{crawler.C, crawler.LinkFinderCollector} {
+		c.OnResponse(func(response *colly.Response) {
+			crawler.budget.Download(len(response.Body))
+			crawler.stats.page()
+		})
+		c.OnError(func(response *colly.Response, err error) {
+			crawler.budget.Download(len(response.Body))
+			if !errors.Is(err, ErrBudgetSpent) {
+				crawler.stats.failure()
+			}
+		})
+	}
+}
 
-	// Set optional blacklist url regex
-	blacklists, _ := cmd.Flags().GetString("blacklist")
-	if blacklists != "" {
-		c.DisallowedURLFilters = append(c.DisallowedURLFilters, regexp.MustCompile(blacklists))
+// allowed tells whether c may request u now
+func (crawler *Crawler) allowed(c *colly.Collector, u *url.URL) bool {
+	return crawler.budget.Stopped() == "" && crawler.inScope(c, u)
+}
+
+// allowedURL is allowed for a raw URL, invalid URLs are not allowed
+func (crawler *Crawler) allowedURL(c *colly.Collector, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && crawler.allowed(c, u)
+}
+
+// inScope tells whether c may request u whatever the budget.
+// The link finder fetches the JavaScript of any host not excluded, like the CDNs of the site.
+func (crawler *Crawler) inScope(c *colly.Collector, u *url.URL) bool {
+	if c == crawler.LinkFinderCollector {
+		if crawler.scope.Excluded(u) {
+			Logger.Debugf("Out of scope: %s", u)
+			return false
+		}
+	} else if !crawler.scope.InScope(u) {
+		Logger.Debugf("Out of scope: %s", u)
+		return false
 	}
+	if !crawler.robotsAllowed(u) {
+		Logger.Debugf("Disallowed by robots.txt: %s", u)
+		return false
+	}
+	return true
+}
 
-	// Set optional whitelist url regex
-	whiteLists, _ := cmd.Flags().GetString("whitelist")
-	if whiteLists != "" {
-		c.URLFilters = make([]*regexp.Regexp, 0)
-		c.URLFilters = append(c.URLFilters, regexp.MustCompile(whiteLists))
+// get sends a GET request outside of the collectors, with the client and headers of the crawler
+func (crawler *Crawler) get(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range crawler.headers {
+		req.Header.Set(k, v)
 	}
+	return crawler.client.Do(req)
+}
 
-	whiteListDomain, _ := cmd.Flags().GetString("whitelist-domain")
-	if whiteListDomain != "" {
-		c.URLFilters = make([]*regexp.Regexp, 0)
-		c.URLFilters = append(c.URLFilters, regexp.MustCompile("http(s)?://"+whiteListDomain))
+// Run crawls the site and every enabled source (sitemap, robots.txt, 3rd party)
+// and blocks until all collectors are done.
+func (crawler *Crawler) Run() {
+	crawler.budget.Start()
+	if err := crawler.setupLimits(); err != nil {
+		Logger.Error(err)
+	}
+	var siteWg sync.WaitGroup
+
+	siteWg.Add(1)
+	go func() {
+		defer siteWg.Done()
+		crawler.Start(crawler.config.LinkFinder)
+	}()
+
+	// Brute force Sitemap path
+	if crawler.config.Sitemap {
+		siteWg.Add(1)
+		go ParseSiteMap(crawler.site, crawler, crawler.C, &siteWg)
 	}
 
-	linkFinderCollector := c.Clone()
-	// Try to request as much as Javascript source and don't care about domain.
-	// The result of link finder will be send to Link Finder Collector to check is it working or not.
-	linkFinderCollector.URLFilters = nil
-	if whiteLists != "" {
-		linkFinderCollector.URLFilters = append(linkFinderCollector.URLFilters, regexp.MustCompile(whiteLists))
+	// Find Robots.txt
+	if crawler.config.Robots {
+		siteWg.Add(1)
+		go ParseRobots(crawler.site, crawler, crawler.C, &siteWg)
 	}
-	if whiteListDomain != "" {
-		linkFinderCollector.URLFilters = append(linkFinderCollector.URLFilters, regexp.MustCompile("http(s)?://"+whiteListDomain))
+
+	// Find URLs from 3rd party
+	if crawler.config.OtherSource {
+		siteWg.Add(1)
+		go ParseOtherSources(crawler.site, crawler, crawler.C, &siteWg)
 	}
 
-	return &Crawler{
-		cmd:                 cmd,
-		C:                   c,
-		LinkFinderCollector: linkFinderCollector,
-		site:                site,
-		Quiet:               quiet,
-		Input:               site.String(),
-		JsonOutput:          jsonOutput,
-		length:              length,
-		raw:                 raw,
-		domain:              domain,
-		Output:              output,
-		urlSet:              stringset.NewStringFilter(),
-		subSet:              stringset.NewStringFilter(),
-		jsSet:               stringset.NewStringFilter(),
-		formSet:             stringset.NewStringFilter(),
-		awsSet:              stringset.NewStringFilter(),
-		filterLength_slice:  filterLength_slice,
+	siteWg.Wait()
+	crawler.wait()
+	crawler.Close()
+	Logger.Infof("Crawl of %s done: %s", crawler.site, crawler.Summary())
+}
 
+// renderAllow lets the browser fetch anything needed to render a page, the other requests
+// of the page, like its XHR and frames, must be in scope and are spent on the budget.
+// The page itself was spent on the budget before its render.
+func renderAllow(scope *Scope, budget *Budget) func(req RenderRequest, static bool) bool {
+	return func(req RenderRequest, static bool) bool {
+		if static && req.Method == "GET" {
+			return true
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || !scope.InScope(u) {
+			return false
+		}
+		return budget.Request(u.Host)
 	}
 }
 
+// visitQueueSize is the number of URLs waiting for C, found by the link finder or the renders.
+// They block when it is full.
+const visitQueueSize = 1000
 
-func (crawler *Crawler) feedLinkfinder(jsFileUrl string, OutputType string, source string, ) {
+// queuedVisit is a URL to visit on C found outside of its callbacks.
+// from is the request of the page it was found on, nil for the link finder URLs.
+type queuedVisit struct {
+	url  string
+	from *colly.Request
+}
 
-	if !crawler.jsSet.Duplicate(jsFileUrl) {
-		outputFormat := fmt.Sprintf("[%s] - %s", OutputType, jsFileUrl)
-
-		if crawler.JsonOutput {
-			sout := SpiderOutput{
-				Input:     crawler.Input,
-				Source:     source,
-				OutputType: OutputType,
-				Output:     jsFileUrl,
+// setupVisits has C visit the URLs found by the link finder and the renders while it crawls.
+// They aren't visited where they are found: a Visit from outside of the callbacks of C
+// while C.Wait blocks races with the WaitGroup of C, which can't be idle during its callbacks.
+func (crawler *Crawler) setupVisits() {
+	crawler.C.OnRequest(func(r *colly.Request) {
+		for {
+			select {
+			case v := <-crawler.visits:
+				crawler.visit(v)
+			default:
+				return
 			}
-			if data, err := jsoniter.MarshalToString(sout); err == nil {
-				outputFormat = data
-				fmt.Println(outputFormat)
+		}
+	})
+}
+
+// wait blocks until both collectors and the renders are idle and the URLs they found are crawled.
+// Once C is idle, the URLs still found are visited after the others are idle too.
+func (crawler *Crawler) wait() {
+	for {
+		crawler.C.Wait()
+
+		othersDone := make(chan struct{})
+		go func() {
+			crawler.LinkFinderCollector.Wait()
+			crawler.renders.Wait()
+			close(othersDone)
+		}()
+		var visits []queuedVisit
+	collect:
+		for {
+			select {
+			case v := <-crawler.visits:
+				visits = append(visits, v)
+			case <-othersDone:
+				break collect
 			}
+		}
+		for len(crawler.visits) > 0 {
+			visits = append(visits, <-crawler.visits)
+		}
 
-		} else if !crawler.Quiet {
-			fmt.Println(outputFormat)
+		if len(visits) == 0 {
+			return
+		}
+		for _, v := range visits {
+			crawler.visit(v)
 		}
+	}
+}
 
-		if crawler.Output != nil {
-			crawler.Output.WriteToFile(outputFormat)
+// visit visits a queued URL on C, a URL of the link finder leaves the frontier
+// when C doesn't request it, like when a page already linked to it
+func (crawler *Crawler) visit(v queuedVisit) {
+	if !crawler.allowedURL(crawler.C, v.url) {
+		return
+	}
+	if v.from != nil {
+		_ = v.from.Visit(v.url)
+		return
+	}
+	if err := crawler.C.Visit(v.url); err != nil && crawler.state != nil {
+		crawler.state.DoneFrontier(v.url)
+	}
+}
+
+// Summary tells what the crawl found, how much it spent and why it stopped early, if it did
+func (crawler *Crawler) Summary() CrawlSummary {
+	summary := crawler.budget.Summary()
+	crawler.stats.fill(&summary)
+	return summary
+}
+
+// Stop stops the crawl: no new request is sent and Run returns once the requests in flight end
+func (crawler *Crawler) Stop() {
+	crawler.budget.Stop("interrupted")
+}
+
+// Close saves the summary in the output folder and closes every result sink, the saved state and the browser of the crawler.
+// Only the first call closes them, Run calls it when the crawl ends.
+func (crawler *Crawler) Close() {
+	crawler.closeOnce.Do(crawler.close)
+}
+
+func (crawler *Crawler) close() {
+	crawler.budget.End()
+	if crawler.output != nil {
+		if err := crawler.output.WriteSummary(crawler.Summary().String()); err != nil {
+			Logger.Errorf("Failed to save summary: %s", err)
 		}
+	}
+	for _, sink := range crawler.sinks {
+		if err := sink.Close(); err != nil {
+			Logger.Errorf("Failed to close output: %s", err)
+		}
+	}
+	if crawler.state != nil {
+		if err := crawler.state.Close(); err != nil {
+			Logger.Errorf("Failed to close state: %s", err)
+		}
+	}
+	if crawler.ownRenderer {
+		if err := crawler.renderer.Close(); err != nil {
+			Logger.Errorf("Failed to close browser: %s", err)
+		}
+	}
+}
+
+// emit sends a finding to every result sink.
+func (crawler *Crawler) emit(out SpiderOutput) {
+	out.Input = crawler.Input
+	crawler.stats.finding(out.OutputType)
+	for _, sink := range crawler.sinks {
+		sink.Write(out)
+	}
+}
+
+func (crawler *Crawler) feedLinkfinder(jsFileUrl string, OutputType string, source string) {
+	if !crawler.jsSet.Duplicate(jsFileUrl) {
+		crawler.emit(SpiderOutput{
+			Source:     source,
+			OutputType: OutputType,
+			Output:     jsFileUrl,
+		})
 
 		// If JS file is minimal format. Try to find original format
 		if strings.Contains(jsFileUrl, ".min.js") {
 			originalJS := strings.ReplaceAll(jsFileUrl, ".min.js", ".js")
-			_ = crawler.LinkFinderCollector.Visit(originalJS)
+			if crawler.allowedURL(crawler.LinkFinderCollector, originalJS) {
+				_ = crawler.LinkFinderCollector.Visit(originalJS)
+			}
 		}
 
 		// Send Javascript to Link Finder Collector
-		_ = crawler.LinkFinderCollector.Visit(jsFileUrl)
-
-	} 
+		if crawler.allowedURL(crawler.LinkFinderCollector, jsFileUrl) {
+			_ = crawler.LinkFinderCollector.Visit(jsFileUrl)
+		}
+	}
 }
 
 func (crawler *Crawler) Start(linkfinder bool) {
@@ -350,6 +772,11 @@ func (crawler *Crawler) Start(linkfinder bool) {
 		crawler.setupLinkFinder()
 	}
 
+	// Setup headless browser rendering
+	if crawler.renderer != nil {
+		crawler.setupRenderer()
+	}
+
 	// Handle url
 	crawler.C.OnHTML("[href]", func(e *colly.HTMLElement) {
 		urlString := e.Request.AbsoluteURL(e.Attr("href"))
@@ -358,51 +785,31 @@ func (crawler *Crawler) Start(linkfinder bool) {
 			return
 		}
 		if !crawler.urlSet.Duplicate(urlString) {
-			outputFormat := fmt.Sprintf("[href] - %s", urlString)
-			if crawler.JsonOutput {
-			sout := SpiderOutput{
-				Input:      crawler.Input,
+			crawler.emit(SpiderOutput{
 				Source:     "body",
-				OutputType: "form",
+				OutputType: "href",
 				Output:     urlString,
+			})
+			if crawler.allowedURL(crawler.C, urlString) {
+				_ = e.Request.Visit(urlString)
 			}
-			if data, err := jsoniter.MarshalToString(sout); err == nil {
-				outputFormat = data
-				fmt.Println(outputFormat)
-			}
-			} else if !crawler.Quiet {
-				fmt.Println(outputFormat)
-			}
-			if crawler.Output != nil {
-					crawler.Output.WriteToFile(outputFormat)
-			}
-			_ = e.Request.Visit(urlString)
 		}
 	})
 
 	// Handle form
-	crawler.C.OnHTML("form[action]", func(e *colly.HTMLElement) {
-		formUrl := e.Request.URL.String()
-		if !crawler.formSet.Duplicate(formUrl) {
-			outputFormat := fmt.Sprintf("[form] - %s", formUrl)
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "form",
-					Output:     formUrl,
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-					fmt.Println(outputFormat)
-				}
-			} else if !crawler.Quiet {
-				fmt.Println(outputFormat)
-			}
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
+	crawler.C.OnHTML("form", func(e *colly.HTMLElement) {
+		form := ParseForm(e)
+		if !crawler.formSet.Duplicate(form.key()) {
+			crawler.emit(SpiderOutput{
+				Source:     "body",
+				OutputType: "form",
+				Method:     form.Method,
+				Output:     form.Action,
+				Form:       form,
+			})
+			if crawler.config.SubmitForms {
+				crawler.submitForm(e, form)
 			}
-
 		}
 	})
 
@@ -411,26 +818,12 @@ func (crawler *Crawler) Start(linkfinder bool) {
 	crawler.C.OnHTML(`input[type="file"]`, func(e *colly.HTMLElement) {
 		uploadUrl := e.Request.URL.String()
 		if !uploadFormSet.Duplicate(uploadUrl) {
-			outputFormat := fmt.Sprintf("[upload-form] - %s", uploadUrl)
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "upload-form",
-					Output:     uploadUrl,
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-					fmt.Println(outputFormat)
-				}
-			} else if !crawler.Quiet {
-				fmt.Println(outputFormat)
-			}
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
-			}
+			crawler.emit(SpiderOutput{
+				Source:     "body",
+				OutputType: "upload-form",
+				Output:     uploadUrl,
+			})
 		}
-
 	})
 
 	// Handle js files
@@ -443,56 +836,34 @@ func (crawler *Crawler) Start(linkfinder bool) {
 
 		fileExt := GetExtType(jsFileUrl)
 		if fileExt == ".js" || fileExt == ".xml" || fileExt == ".json" {
-			crawler.feedLinkfinder(jsFileUrl,"javascript","body")
+			crawler.feedLinkfinder(jsFileUrl, "javascript", "body")
 		}
 	})
 
 	crawler.C.OnResponse(func(response *colly.Response) {
 		respStr := DecodeChars(string(response.Body))
 
-		if len(crawler.filterLength_slice) == 0 || !contains(crawler.filterLength_slice,len(respStr)) {
-
+		if len(crawler.filterLength_slice) == 0 || !contains(crawler.filterLength_slice, len(respStr)) {
 			// Verify which link is working
-			u := response.Request.URL.String()
-			outputFormat := fmt.Sprintf("[url] - [code-%d] - %s", response.StatusCode, u)
-
-			if crawler.length {
-				outputFormat = fmt.Sprintf("[url] - [code-%d] - [len_%d] - %s", response.StatusCode, len(respStr), u)
-			}
+			crawler.emit(SpiderOutput{
+				Source:        "body",
+				OutputType:    "url",
+				StatusCode:    response.StatusCode,
+				Output:        response.Request.URL.String(),
+				Length:        strings.Count(respStr, "\n"),
+				ContentLength: len(respStr),
+			})
 
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "url",
-					StatusCode: response.StatusCode,
-					Output:     u,
-					Length:     strings.Count(respStr, "\n"),
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-				}
-			} else if crawler.Quiet {
-				outputFormat = u
-			}
-			fmt.Println(outputFormat)
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
-			}
-			if InScope(response.Request.URL, crawler.C.URLFilters) {
+			if crawler.scope.InScope(response.Request.URL) {
 				crawler.findSubdomains(respStr)
-				crawler.findAWSS3(respStr)
+				crawler.findCloudAssets(respStr, response.Request.URL.String())
+				crawler.findSecrets(respStr, response.Request.URL.String())
+				crawler.fingerprint(response)
 			}
 
-			if crawler.raw { 
-				outputFormat := fmt.Sprintf("[Raw] - \n%s\n", respStr)  //PRINTCLEAN RAW for link visited only
-				if !crawler.Quiet { 
-					fmt.Println(outputFormat)
-				}
-				if crawler.Output != nil {
-					crawler.Output.WriteToFile(outputFormat)
-				}
-			}			
+			if crawler.raw {
+				crawler.emitRaw(response, respStr)
+			}
 		}
 	})
 
@@ -509,91 +880,48 @@ func (crawler *Crawler) Start(linkfinder bool) {
 			return
 		}
 
-		u := response.Request.URL.String()
-		outputFormat := fmt.Sprintf("[url] - [code-%d] - %s", response.StatusCode, u)
-
-		if crawler.JsonOutput {
-			sout := SpiderOutput{
-				Input:      crawler.Input,
-				Source:     "body",
-				OutputType: "url",
-				StatusCode: response.StatusCode,
-				Output:     u,
-				Length:     strings.Count(DecodeChars(string(response.Body)), "\n"),
-			}
-			if data, err := jsoniter.MarshalToString(sout); err == nil {
-				outputFormat = data
-				fmt.Println(outputFormat)
-			}
-		} else if crawler.Quiet {
-			fmt.Println(u)
-		} else {
-			fmt.Println(outputFormat)
-		}
-
-		if crawler.Output != nil {
-			crawler.Output.WriteToFile(outputFormat)
-		}
+		respStr := DecodeChars(string(response.Body))
+		crawler.emit(SpiderOutput{
+			Source:        "body",
+			OutputType:    "url",
+			StatusCode:    response.StatusCode,
+			Output:        response.Request.URL.String(),
+			Length:        strings.Count(respStr, "\n"),
+			ContentLength: len(respStr),
+		})
 	})
 
+	resume := crawler.state != nil && crawler.config.Resume
+	if resume {
+		crawler.resumeFrontier()
+	}
+
 	err := crawler.C.Visit(crawler.site.String())
-	if err != nil {
+	if err != nil && !(resume && err == colly.ErrAlreadyVisited) {
 		Logger.Errorf("Failed to start %s: %s", crawler.site.String(), err)
 	}
 }
 
+// Emit the raw body of a visited link
+func (crawler *Crawler) emitRaw(response *colly.Response, respStr string) {
+	crawler.emit(SpiderOutput{
+		Source:     response.Request.URL.String(),
+		OutputType: "raw",
+		StatusCode: response.StatusCode,
+		Output:     respStr,
+	})
+}
+
 // Find subdomains from response
 func (crawler *Crawler) findSubdomains(resp string) {
 	subs := GetSubdomains(resp, crawler.domain)
 	for _, sub := range subs {
 		if !crawler.subSet.Duplicate(sub) {
-			outputFormat := fmt.Sprintf("[subdomains] - %s", sub)
-
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "subdomain",
-					Output:     sub,
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-				}
-				fmt.Println(outputFormat)
-			} else if !crawler.Quiet {
-				outputFormat = fmt.Sprintf("[subdomains] - http://%s", sub)
-				fmt.Println(outputFormat)
-				outputFormat = fmt.Sprintf("[subdomains] - https://%s", sub)
-				fmt.Println(outputFormat)
-			}
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
-			}
-		}
-	}
-}
-
-// Find AWS S3 from response
-func (crawler *Crawler) findAWSS3(resp string) {
-	aws := GetAWSS3(resp)
-	for _, e := range aws {
-		if !crawler.awsSet.Duplicate(e) {
-			outputFormat := fmt.Sprintf("[aws-s3] - %s", e)
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "aws",
-					Output:     e,
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-				}
-			}
-			fmt.Println(outputFormat)
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
-			}
+			crawler.emit(SpiderOutput{
+				Source:     "body",
+				OutputType: "subdomain",
+				Output:     sub,
+			})
 		}
 	}
 }
@@ -607,166 +935,129 @@ func (crawler *Crawler) setupLinkFinder() {
 
 		respStr := string(response.Body)
 
-		if len(crawler.filterLength_slice) == 0 || !contains(crawler.filterLength_slice,len(respStr)) {
-
+		if len(crawler.filterLength_slice) == 0 || !contains(crawler.filterLength_slice, len(respStr)) {
 			// Verify which link is working
 			u := response.Request.URL.String()
-			outputFormat := fmt.Sprintf("[url] - [code-%d] - %s", response.StatusCode, u)
-
-			if crawler.length {
-				outputFormat = fmt.Sprintf("[url] - [code-%d] - [len_%d] - %s", response.StatusCode, len(respStr), u)
-			}
+			crawler.emit(SpiderOutput{
+				Source:        "body",
+				OutputType:    "url",
+				StatusCode:    response.StatusCode,
+				Output:        u,
+				Length:        strings.Count(respStr, "\n"),
+				ContentLength: len(respStr),
+			})
 
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "body",
-					OutputType: "url",
-					StatusCode: response.StatusCode,
-					Output:     u,
-					Length:     strings.Count(respStr, "\n"),
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
+			if crawler.scope.InScope(response.Request.URL) {
+				crawler.fingerprint(response)
+				// The original sources of a source map are analyzed instead of the map
+				if looksLikeSourceMap(response.Body) {
+					if sm, err := ParseSourceMap(response.Body); err == nil {
+						crawler.recoverSources(sm, response.Request.URL)
+					} else {
+						crawler.analyzeJS(respStr, response.Request.URL)
+					}
+				} else {
+					crawler.analyzeJS(respStr, response.Request.URL)
+					crawler.findSourceMap(response.Body, *response.Headers, response.Request.URL)
 				}
-			} else if crawler.Quiet {
-				outputFormat = u
-			}
-			fmt.Println(outputFormat)
-
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
-			}
-
-			if InScope(response.Request.URL, crawler.C.URLFilters) {			
-
-				crawler.findSubdomains(respStr)
-				crawler.findAWSS3(respStr)
 
-				paths, err := LinkFinder(respStr)
-				if err != nil {
-					Logger.Error(err)
-					return
+				if crawler.raw {
+					crawler.emitRaw(response, respStr)
 				}
+			}
+		}
+	})
+}
 
-			  	currentPathURL, err := url.Parse(u)
-				currentPathURLerr := false
-				if err != nil {
-					currentPathURLerr = true
-				}
+// analyzeJS reports the subdomains, cloud assets, secrets and endpoints of a JavaScript source
+// and sends the endpoints to the collectors. from is the URL of the source.
+func (crawler *Crawler) analyzeJS(source string, from *url.URL) {
+	u := from.String()
+	crawler.findSubdomains(source)
+	crawler.findCloudAssets(source, u)
+	crawler.findSecrets(source, u)
 
-				for _, relPath := range paths {
-					var outputFormat string
-					// JS Regex Result
-					if crawler.JsonOutput {
-						sout := SpiderOutput{
-							Input:      crawler.Input,
-							Source:     response.Request.URL.String(),
-							OutputType: "linkfinder",
-							Output:     relPath,
-						}
-						if data, err := jsoniter.MarshalToString(sout); err == nil {
-							outputFormat = data
-						}
-					} else if !crawler.Quiet {
-						outputFormat = fmt.Sprintf("[linkfinder] - [from: %s] - %s", response.Request.URL.String(), relPath)
-					}
-					fmt.Println(outputFormat)
+	endpoints, err := crawler.findEndpoints(source)
+	if err != nil {
+		Logger.Error(err)
+		return
+	}
 
-					if crawler.Output != nil {
-						crawler.Output.WriteToFile(outputFormat)
-					}
-					rebuildURL := ""
-					if !currentPathURLerr { 
-						rebuildURL = FixUrl(currentPathURL, relPath)
-					} else { 
-						rebuildURL = FixUrl(crawler.site, relPath) 
-					}
+	for _, endpoint := range endpoints {
+		relPath := endpoint.URL
+		// JS Regex and AST Result
+		crawler.emit(SpiderOutput{
+			Source:     u,
+			OutputType: "linkfinder",
+			Method:     endpoint.Method,
+			Output:     relPath,
+		})
 
-					
-					if rebuildURL == "" {
-						continue
-					}
+		rebuildURL := FixUrl(from, relPath)
+		if rebuildURL == "" {
+			continue
+		}
 
-					// Try to request JS path
-					// Try to generate URLs with main site
-					fileExt := GetExtType(rebuildURL)
-					if fileExt == ".js" || fileExt == ".xml" || fileExt == ".json" || fileExt == ".map" {
-							crawler.feedLinkfinder(rebuildURL,"linkfinder","javascript")
-					}else if !crawler.urlSet.Duplicate(rebuildURL){
-
-						if crawler.JsonOutput {
-							sout := SpiderOutput{
-								Input:      crawler.Input,
-								Source:     response.Request.URL.String(),
-								OutputType: "linkfinder",
-								Output:     rebuildURL,
-							}
-							if data, err := jsoniter.MarshalToString(sout); err == nil {
-								outputFormat = data
-							}
-						} else if !crawler.Quiet{
-							outputFormat = fmt.Sprintf("[linkfinder] - %s", rebuildURL)
-						}
-
-						fmt.Println(outputFormat)
-
-						if crawler.Output != nil {
-							crawler.Output.WriteToFile(outputFormat)
-						}
-						_ = crawler.C.Visit(rebuildURL)
-					}
+		// Try to request JS path
+		// Try to generate URLs with main site
+		crawler.feedLinkfinderURL(rebuildURL, u, endpoint.Method)
 
-					// Try to generate URLs with the site where Javascript file host in (must be in main or sub domain)
-
-					urlWithJSHostIn := FixUrl(crawler.site, relPath)
-					if urlWithJSHostIn != ""  {
-						fileExt := GetExtType(urlWithJSHostIn)
-						if fileExt == ".js" || fileExt == ".xml" || fileExt == ".json" || fileExt == ".map" {
-								crawler.feedLinkfinder(urlWithJSHostIn,"linkfinder","javascript")
-							}else{
-							if crawler.urlSet.Duplicate(urlWithJSHostIn){
-								continue
-							}else{
-
-								if crawler.JsonOutput {
-									sout := SpiderOutput{
-										Input:      crawler.Input,
-										Source:     response.Request.URL.String(),
-										OutputType: "linkfinder",
-										Output:     urlWithJSHostIn,
-									}
-									if data, err := jsoniter.MarshalToString(sout); err == nil {
-										outputFormat = data
-									}
-								} else if !crawler.Quiet{
-									outputFormat = fmt.Sprintf("[linkfinder] - %s", urlWithJSHostIn)
-								}
-								fmt.Println(outputFormat)
-
-								if crawler.Output != nil {
-									crawler.Output.WriteToFile(outputFormat)
-								}
-								 _ = crawler.C.Visit(urlWithJSHostIn)  //not print care for lost link
-							}
-						}
+		// Try to generate URLs with the site where Javascript file host in (must be in main or sub domain)
+		urlWithJSHostIn := FixUrl(crawler.site, relPath)
+		if urlWithJSHostIn != "" {
+			crawler.feedLinkfinderURL(urlWithJSHostIn, u, endpoint.Method)
+		}
+	}
+}
 
-					}
-					
-				}
-				
-				if crawler.raw{ 
+// findEndpoints merges the LinkFinder regex results with the endpoints found in the
+// JavaScript AST, which adds the HTTP methods and the concatenated URLs.
+// Sources which don't parse as JavaScript, like JSON, only get the regex results.
+func (crawler *Crawler) findEndpoints(source string) ([]JSEndpoint, error) {
+	paths, err := LinkFinder(source)
+	if err != nil {
+		return nil, err
+	}
+	jsEndpoints, err := JSEndpoints(source)
+	if err != nil {
+		Logger.Debugf("Failed to parse JavaScript: %s", err)
+	}
 
-					outputFormat := fmt.Sprintf("[Raw] - \n%s\n", respStr)  //PRINTCLEAN RAW for link visited only
-					if !crawler.Quiet { 
-						fmt.Println(outputFormat)
-					}
+	var endpoints []JSEndpoint
+	index := make(map[string]int)
+	for _, endpoint := range jsEndpoints {
+		index[endpoint.URL] = len(endpoints)
+		endpoints = append(endpoints, endpoint)
+	}
+	for _, path := range paths {
+		if _, ok := index[path]; !ok {
+			endpoints = append(endpoints, JSEndpoint{URL: path})
+		}
+	}
+	return endpoints, nil
+}
 
-					if crawler.Output != nil {
-						crawler.Output.WriteToFile(outputFormat)
-					}
-				}
+// feedLinkfinderURL sends a URL rebuilt from a link finder result to the right collector.
+// Only the GET endpoints are visited, the others are just reported.
+func (crawler *Crawler) feedLinkfinderURL(rebuildURL string, source string, method string) {
+	fileExt := GetExtType(rebuildURL)
+	if fileExt == ".js" || fileExt == ".xml" || fileExt == ".json" || fileExt == ".map" {
+		crawler.feedLinkfinder(rebuildURL, "linkfinder", "javascript")
+	} else if !crawler.urlSet.Duplicate(rebuildURL) {
+		crawler.emit(SpiderOutput{
+			Source:     source,
+			OutputType: "linkfinder",
+			Method:     method,
+			Output:     rebuildURL,
+		})
+		// The {name} placeholders of the unknown parts of the URL can't be visited
+		placeholder := strings.Contains(rebuildURL, "{") || strings.Contains(rebuildURL, "%7B")
+		if (method == "" || method == "GET") && !placeholder && crawler.allowedURL(crawler.C, rebuildURL) {
+			// The URL is already in the saved URL set, a killed crawl resumes it from the frontier
+			if crawler.state != nil {
+				crawler.state.AddFrontier(rebuildURL, "main", 1)
 			}
+			crawler.visits <- queuedVisit{url: rebuildURL}
 		}
-	})
+	}
 }
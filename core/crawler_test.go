@@ -0,0 +1,129 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewCrawler(t *testing.T) {
+	site, _ := url.Parse("https://example.com")
+	cfg := NewCrawlerConfig()
+	cfg.Blacklist = `logout`
+
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crawler.scope.InScopeURL("https://example.com/a") || crawler.scope.InScopeURL("https://example.com/logout") {
+		t.Errorf("unexpected scope: %v", crawler.scope.Rules)
+	}
+	if len(crawler.C.DisallowedURLFilters) != 1 {
+		t.Errorf("expected default filter, got %v", crawler.C.DisallowedURLFilters)
+	}
+
+	cfg.Blacklist = `(`
+	if _, err := NewCrawler(site, cfg); err == nil {
+		t.Error("expected error for invalid blacklist regex")
+	}
+}
+
+func TestRunWaitsForLinkfinder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><script src="/app.js"></script></html>`))
+		case "/app.js":
+			_, _ = w.Write([]byte(`fetch("/api/users")`))
+		case "/api/users":
+			_, _ = w.Write([]byte(`<a href="/profile">profile</a>`))
+		}
+	}))
+	defer ts.Close()
+
+	site, _ := url.Parse(ts.URL)
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 2
+	cfg.Robots = false
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	// The sinks are closed once both collectors are done, nothing is sent after Run
+	close(ch)
+
+	found := make(map[string]bool)
+	for out := range ch {
+		found[out.OutputType+" "+out.Output] = true
+	}
+	// The URL found in the script is crawled before Run returns
+	for _, want := range []string{"url " + ts.URL + "/api/users", "href " + ts.URL + "/profile"} {
+		if !found[want] {
+			t.Errorf("%s not found: %v", want, found)
+		}
+	}
+}
+
+func TestNewCrawlerClosesOnError(t *testing.T) {
+	site, _ := url.Parse("https://example.com")
+	cfg := NewCrawlerConfig()
+	cfg.StateDir = t.TempDir()
+	cfg.OutputFolder = t.TempDir()
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 1))}
+	cfg.Render = true
+	cfg.ChromePath = "/nonexistent/chromium"
+	if _, err := NewCrawler(site, cfg); err == nil {
+		t.Fatal("expected an error for a missing browser")
+	}
+
+	// The state of the failed crawler is released, resuming it doesn't wait for its lock
+	cfg.Render = false
+	cfg.Resume = true
+	done := make(chan error, 1)
+	go func() {
+		crawler, err := NewCrawler(site, cfg)
+		if err == nil {
+			crawler.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("state still locked by the failed crawler")
+	}
+}
+
+func TestLinkfinderURLsInFrontier(t *testing.T) {
+	site, _ := url.Parse("https://example.com")
+	cfg := NewCrawlerConfig()
+	cfg.StateDir = t.TempDir()
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 10))}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crawler.Close()
+
+	// A URL waiting for C is resumed when the crawl is killed before visiting it
+	crawler.feedLinkfinderURL("https://example.com/api/users", "https://example.com/app.js", "")
+	entries, err := crawler.state.Frontier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := frontierEntry{URL: "https://example.com/api/users", Collector: "main", Depth: 1}
+	if len(entries) != 1 || entries[0] != want {
+		t.Errorf("unexpected frontier %+v", entries)
+	}
+	if v := <-crawler.visits; v.url != want.URL {
+		t.Errorf("unexpected URL handed over to C: %s", v.url)
+	}
+}
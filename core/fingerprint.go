@@ -0,0 +1,496 @@
+package core
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+//go:embed technologies.json
+var defaultTechnologies []byte
+
+var (
+	defaultFingerprinterOnce sync.Once
+	defaultFingerprinter     *Fingerprinter
+)
+
+// Technology is a technology detected in a response
+type Technology struct {
+	Host       string   `json:"host,omitempty"`
+	Name       string   `json:"name"`
+	Version    string   `json:"version,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// Confidence is the sum of the confidences of the matching patterns, up to 100
+	Confidence int `json:"confidence"`
+}
+
+// Fingerprinter detects the technologies of the responses with Wappalyzer rules:
+// the headers, cookies, meta, scriptSrc, html, url, implies and excludes fields are used,
+// the ones needing a browser like js and dom are ignored.
+type Fingerprinter struct {
+	technologies []*technology
+}
+
+type technology struct {
+	name       string
+	categories []string
+	headers    map[string][]*techPattern
+	cookies    map[string][]*techPattern
+	meta       map[string][]*techPattern
+	scriptSrc  []*techPattern
+	html       []*techPattern
+	url        []*techPattern
+	implies    []*techPattern
+	excludes   []string
+}
+
+// techPattern is a Wappalyzer pattern: a regex followed by \;version:\1 or \;confidence:50 tags.
+// For implies, the regex is the name of the implied technology.
+type techPattern struct {
+	value      string
+	re         *regexp.Regexp
+	version    string
+	confidence int
+}
+
+// wappalyzerTech is a technology of a Wappalyzer rules file.
+// Its fields are either a string or a list of strings.
+type wappalyzerTech struct {
+	Cats      []int                 `json:"cats"`
+	Headers   map[string]stringList `json:"headers"`
+	Cookies   map[string]stringList `json:"cookies"`
+	Meta      map[string]stringList `json:"meta"`
+	ScriptSrc stringList            `json:"scriptSrc"`
+	// Script is the name of scriptSrc in the older rules files
+	Script   stringList `json:"script"`
+	HTML     stringList `json:"html"`
+	URL      stringList `json:"url"`
+	Implies  stringList `json:"implies"`
+	Excludes stringList `json:"excludes"`
+}
+
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// wappalyzerRules are the technologies and categories of one or more rules files
+type wappalyzerRules struct {
+	technologies map[string]wappalyzerTech
+	categories   map[string]string
+}
+
+// add reads a rules file: the apps.json layout with technologies and categories,
+// a file of technologies only, or the categories.json of a Wappalyzer checkout
+func (r *wappalyzerRules) add(data []byte, categoriesOnly bool) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return err
+	}
+	techs, cats := top["technologies"], top["categories"]
+	if categoriesOnly {
+		techs, cats = nil, data
+	} else if techs == nil && cats == nil {
+		techs = data
+	}
+	if cats != nil {
+		var categories map[string]struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(cats, &categories); err != nil {
+			return fmt.Errorf("invalid categories: %s", err)
+		}
+		for id, category := range categories {
+			r.categories[id] = category.Name
+		}
+	}
+	if techs != nil {
+		var technologies map[string]wappalyzerTech
+		if err := json.Unmarshal(techs, &technologies); err != nil {
+			return fmt.Errorf("invalid technologies: %s", err)
+		}
+		for name, tech := range technologies {
+			r.technologies[name] = tech
+		}
+	}
+	return nil
+}
+
+// ParseFingerprints reads Wappalyzer rules, in the apps.json layout or a file of technologies
+func ParseFingerprints(data []byte) (*Fingerprinter, error) {
+	rules := &wappalyzerRules{technologies: make(map[string]wappalyzerTech), categories: make(map[string]string)}
+	if err := rules.add(data, false); err != nil {
+		return nil, err
+	}
+	return newFingerprinter(rules), nil
+}
+
+// LoadFingerprints reads Wappalyzer rules from a file, or from a folder of rules files
+// like the technologies folder of Wappalyzer, with its categories.json
+func LoadFingerprints(filename string) (*Fingerprinter, error) {
+	filename = NormalizePath(filename)
+	files := []string{filename}
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		files, _ = filepath.Glob(filepath.Join(filename, "*.json"))
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no rules file in %s", filename)
+		}
+	}
+
+	rules := &wappalyzerRules{technologies: make(map[string]wappalyzerTech), categories: make(map[string]string)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := rules.add(data, filepath.Base(file) == "categories.json"); err != nil {
+			return nil, fmt.Errorf("failed to parse technologies %s: %s", file, err)
+		}
+	}
+	return newFingerprinter(rules), nil
+}
+
+// DefaultFingerprinter returns the fingerprinter of the rules shipped with the crawler
+func DefaultFingerprinter() *Fingerprinter {
+	defaultFingerprinterOnce.Do(func() {
+		f, err := ParseFingerprints(defaultTechnologies)
+		if err != nil {
+			panic("invalid default technologies: " + err.Error())
+		}
+		defaultFingerprinter = f
+	})
+	return defaultFingerprinter
+}
+
+func newFingerprinter(rules *wappalyzerRules) *Fingerprinter {
+	f := &Fingerprinter{}
+	for name, rule := range rules.technologies {
+		tech := &technology{
+			name:      name,
+			headers:   parseTechPatternMap(name, rule.Headers),
+			cookies:   parseTechPatternMap(name, rule.Cookies),
+			meta:      parseTechPatternMap(name, rule.Meta),
+			scriptSrc: parseTechPatterns(name, append(rule.ScriptSrc, rule.Script...)),
+			html:      parseTechPatterns(name, rule.HTML),
+			url:       parseTechPatterns(name, rule.URL),
+			excludes:  rule.Excludes,
+		}
+		for _, implied := range rule.Implies {
+			tech.implies = append(tech.implies, parseTechTags(implied))
+		}
+		for _, id := range rule.Cats {
+			category, ok := rules.categories[strconv.Itoa(id)]
+			if !ok {
+				category = strconv.Itoa(id)
+			}
+			tech.categories = append(tech.categories, category)
+		}
+		f.technologies = append(f.technologies, tech)
+	}
+	sort.Slice(f.technologies, func(i, j int) bool { return f.technologies[i].name < f.technologies[j].name })
+	return f
+}
+
+// parseTechTags splits a pattern from its tags
+func parseTechTags(s string) *techPattern {
+	parts := strings.Split(s, `\;`)
+	p := &techPattern{value: parts[0], confidence: 100}
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "version":
+			p.version = kv[1]
+		case "confidence":
+			if confidence, err := strconv.Atoi(kv[1]); err == nil {
+				p.confidence = confidence
+			}
+		}
+	}
+	return p
+}
+
+// parseTechPatterns compiles the patterns, the ones Go can't compile like lookaheads are skipped
+func parseTechPatterns(name string, patterns []string) []*techPattern {
+	var parsed []*techPattern
+	for _, pattern := range patterns {
+		p := parseTechTags(pattern)
+		// An empty pattern matches any value, like a header which is only present
+		if p.value != "" {
+			re, err := regexp.Compile("(?i)" + p.value)
+			if err != nil {
+				Logger.Debugf("Skipping a pattern of %s: %s", name, err)
+				continue
+			}
+			p.re = re
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed
+}
+
+func parseTechPatternMap(name string, patterns map[string]stringList) map[string][]*techPattern {
+	if len(patterns) == 0 {
+		return nil
+	}
+	parsed := make(map[string][]*techPattern, len(patterns))
+	for key, list := range patterns {
+		if len(list) == 0 {
+			list = stringList{""}
+		}
+		parsed[strings.ToLower(key)] = parseTechPatterns(name, list)
+	}
+	return parsed
+}
+
+// match tells whether value matches and the version it gives
+func (p *techPattern) match(value string) (string, bool) {
+	if p.re == nil {
+		return "", true
+	}
+	m := p.re.FindStringSubmatch(value)
+	if m == nil {
+		return "", false
+	}
+	return p.resolveVersion(m), true
+}
+
+var (
+	versionTernaryRegex = regexp.MustCompile(`\\(\d)\?([^:]*):(.*)$`)
+	versionGroupRegex   = regexp.MustCompile(`\\(\d)`)
+)
+
+// resolveVersion fills the version template of the pattern, like \1 or \1?next:old, with the groups of m
+func (p *techPattern) resolveVersion(m []string) string {
+	if p.version == "" {
+		return ""
+	}
+	group := func(ref string) string {
+		i, _ := strconv.Atoi(ref)
+		if i < len(m) {
+			return m[i]
+		}
+		return ""
+	}
+	version := p.version
+	if t := versionTernaryRegex.FindStringSubmatchIndex(version); t != nil {
+		branch := version[t[6]:t[7]]
+		if group(version[t[2]:t[3]]) != "" {
+			branch = version[t[4]:t[5]]
+		}
+		version = version[:t[0]] + branch
+	}
+	version = versionGroupRegex.ReplaceAllStringFunc(version, func(ref string) string {
+		return group(ref[1:])
+	})
+	return strings.TrimSpace(version)
+}
+
+var (
+	metaTagRegex   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrRegex  = regexp.MustCompile(`(?is)\b(name|property|content)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	scriptSrcRegex = regexp.MustCompile(`(?is)<script\b[^>]*\ssrc\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// Fingerprint returns the technologies of a response, sorted by name
+func (f *Fingerprinter) Fingerprint(rawURL string, header http.Header, body []byte) []Technology {
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	html := strings.Contains(contentType, "html") ||
+		(contentType == "" && strings.HasPrefix(strings.TrimSpace(string(body[:min(len(body), 512)])), "<"))
+
+	var (
+		meta    map[string][]string
+		scripts []string
+		source  string
+	)
+	if html {
+		source = string(body)
+		meta = make(map[string][]string)
+		for _, tag := range metaTagRegex.FindAllString(source, -1) {
+			var name, content string
+			for _, attr := range metaAttrRegex.FindAllStringSubmatch(tag, -1) {
+				value := attr[2] + attr[3]
+				if strings.EqualFold(attr[1], "content") {
+					content = value
+				} else {
+					name = strings.ToLower(value)
+				}
+			}
+			if name != "" {
+				meta[name] = append(meta[name], content)
+			}
+		}
+		for _, m := range scriptSrcRegex.FindAllStringSubmatch(source, -1) {
+			scripts = append(scripts, m[1])
+		}
+	} else if strings.Contains(contentType, "javascript") || GetExtType(rawURL) == ".js" {
+		// A script fetched on its own is matched by its URL
+		scripts = []string{rawURL}
+	}
+
+	cookies := make(map[string][]string)
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		name := strings.ToLower(cookie.Name)
+		cookies[name] = append(cookies[name], cookie.Value)
+	}
+	headers := make(map[string][]string, len(header))
+	for name, values := range header {
+		headers[strings.ToLower(name)] = values
+	}
+
+	detected := make(map[string]*Technology)
+	for _, tech := range f.technologies {
+		tech.detect(detected, headers, tech.headers)
+		tech.detect(detected, cookies, tech.cookies)
+		tech.detect(detected, meta, tech.meta)
+		tech.detectAll(detected, []string{rawURL}, tech.url)
+		tech.detectAll(detected, scripts, tech.scriptSrc)
+		if html {
+			tech.detectAll(detected, []string{source}, tech.html)
+		}
+	}
+	f.resolveImplies(detected)
+
+	technologies := make([]Technology, 0, len(detected))
+	for _, tech := range detected {
+		technologies = append(technologies, *tech)
+	}
+	sort.Slice(technologies, func(i, j int) bool { return technologies[i].Name < technologies[j].Name })
+	return technologies
+}
+
+// detect matches the patterns of a field keyed by name, like the headers
+func (t *technology) detect(detected map[string]*Technology, values map[string][]string, patterns map[string][]*techPattern) {
+	for key, keyPatterns := range patterns {
+		if list, ok := values[key]; ok {
+			t.detectAll(detected, list, keyPatterns)
+		}
+	}
+}
+
+func (t *technology) detectAll(detected map[string]*Technology, values []string, patterns []*techPattern) {
+	for _, p := range patterns {
+		for _, value := range values {
+			if version, ok := p.match(value); ok {
+				t.found(detected, version, p.confidence)
+				break
+			}
+		}
+	}
+}
+
+// found records a match, the confidences add up and the longest version wins
+func (t *technology) found(detected map[string]*Technology, version string, confidence int) {
+	tech, ok := detected[t.name]
+	if !ok {
+		tech = &Technology{Name: t.name, Categories: t.categories}
+		detected[t.name] = tech
+	}
+	tech.Confidence += confidence
+	if tech.Confidence > 100 {
+		tech.Confidence = 100
+	}
+	if len(version) > len(tech.Version) {
+		tech.Version = version
+	}
+}
+
+// resolveImplies adds the technologies implied by the detected ones and removes the excluded ones
+func (f *Fingerprinter) resolveImplies(detected map[string]*Technology) {
+	byName := make(map[string]*technology, len(f.technologies))
+	for _, tech := range f.technologies {
+		byName[tech.name] = tech
+	}
+	queue := make([]string, 0, len(detected))
+	for name := range detected {
+		queue = append(queue, name)
+	}
+	sort.Strings(queue)
+	for len(queue) > 0 {
+		tech := byName[queue[0]]
+		queue = queue[1:]
+		if tech == nil {
+			continue
+		}
+		for _, implied := range tech.implies {
+			if _, ok := detected[implied.value]; ok {
+				continue
+			}
+			impliedTech, ok := byName[implied.value]
+			if !ok {
+				continue
+			}
+			impliedTech.found(detected, "", implied.confidence)
+			queue = append(queue, implied.value)
+		}
+	}
+	for name := range detected {
+		if tech := byName[name]; tech != nil {
+			for _, excluded := range tech.excludes {
+				delete(detected, excluded)
+			}
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// fingerprint reports the technologies of a response, once per host.
+// A technology found with a version after being found without is reported again.
+func (crawler *Crawler) fingerprint(response *colly.Response) {
+	if crawler.fingerprinter == nil || response.Headers == nil {
+		return
+	}
+	host := response.Request.URL.Host
+	for _, tech := range crawler.fingerprinter.Fingerprint(response.Request.URL.String(), *response.Headers, response.Body) {
+		tech := tech
+		tech.Host = host
+		key := strings.ToLower(host + "|" + tech.Name)
+		if tech.Version != "" {
+			crawler.techSet.Duplicate(key)
+			key += "|" + strings.ToLower(tech.Version)
+		}
+		if crawler.techSet.Duplicate(key) {
+			continue
+		}
+		output := tech.Name
+		if tech.Version != "" {
+			output += " " + tech.Version
+		}
+		crawler.emit(SpiderOutput{
+			Source:     response.Request.URL.String(),
+			OutputType: "technology",
+			Output:     output,
+			Technology: &tech,
+		})
+	}
+}
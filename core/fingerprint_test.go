@@ -0,0 +1,156 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func techByName(technologies []Technology) map[string]Technology {
+	found := make(map[string]Technology)
+	for _, tech := range technologies {
+		found[tech.Name] = tech
+	}
+	return found
+}
+
+func TestFingerprint(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Server", "nginx/1.18.0")
+	header.Add("Set-Cookie", "PHPSESSID=abc; path=/")
+	body := []byte(`<html><head>
+<meta name="generator" content="WordPress 6.4.2" />
+<script src="https://code.jquery.com/jquery-3.6.0.min.js"></script>
+</head></html>`)
+
+	found := techByName(DefaultFingerprinter().Fingerprint("https://example.com/", header, body))
+	for name, version := range map[string]string{
+		"Nginx":     "1.18.0",
+		"WordPress": "6.4.2",
+		"jQuery":    "3.6.0",
+		"PHP":       "",
+		// Implied by WordPress
+		"MySQL": "",
+	} {
+		tech, ok := found[name]
+		if !ok {
+			t.Errorf("%s not detected: %+v", name, found)
+			continue
+		}
+		if tech.Version != version {
+			t.Errorf("version of %s = %q, want %q", name, tech.Version, version)
+		}
+	}
+	if categories := found["Nginx"].Categories; len(categories) == 0 || categories[0] != "Web servers" {
+		t.Errorf("unexpected categories of Nginx %v", categories)
+	}
+
+	// A script is matched by its URL, its body isn't HTML
+	header = http.Header{}
+	header.Set("Content-Type", "application/javascript")
+	found = techByName(DefaultFingerprinter().Fingerprint("https://example.com/js/jquery-1.12.4.min.js", header, []byte(`<meta name="generator" content="WordPress">`)))
+	if found["jQuery"].Version != "1.12.4" || len(found) != 1 {
+		t.Errorf("unexpected technologies of a script %+v", found)
+	}
+}
+
+func TestFingerprintRules(t *testing.T) {
+	f, err := ParseFingerprints([]byte(`{
+		"categories": {"1": {"name": "Frameworks"}},
+		"technologies": {
+			"Acme": {
+				"cats": [1, 2],
+				"headers": {"X-Acme": "^acme/(\\d+)(beta)?\\;version:\\2?\\1-beta:\\1"},
+				"implies": "Base\\;confidence:50",
+				"excludes": ["Other"]
+			},
+			"Base": {"cats": [1]},
+			"Other": {"html": "acme"},
+			"Lookahead": {"html": "a(?=b)"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set("X-Acme", "acme/2beta")
+	header.Set("Content-Type", "text/html")
+	found := techByName(f.Fingerprint("https://example.com/", header, []byte("<p>acme</p>")))
+	if len(found) != 2 {
+		t.Errorf("unexpected technologies %+v", found)
+	}
+	acme := found["Acme"]
+	if acme.Version != "2-beta" || acme.Confidence != 100 || len(acme.Categories) != 2 || acme.Categories[0] != "Frameworks" || acme.Categories[1] != "2" {
+		t.Errorf("unexpected Acme %+v", acme)
+	}
+	if found["Base"].Confidence != 50 {
+		t.Errorf("unexpected Base %+v", found["Base"])
+	}
+
+	// A folder of Wappalyzer files
+	dir := t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(dir, "categories.json"), []byte(`{"5": {"name": "Widgets"}}`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"Gizmo": {"cats": [5], "cookies": {"gizmo_session": ""}}}`), 0644)
+	f, err = LoadFingerprints(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = http.Header{}
+	header.Add("Set-Cookie", "gizmo_session=1")
+	found = techByName(f.Fingerprint("https://example.com/", header, nil))
+	if gizmo, ok := found["Gizmo"]; !ok || len(gizmo.Categories) != 1 || gizmo.Categories[0] != "Widgets" {
+		t.Errorf("unexpected technologies %+v", found)
+	}
+
+	if _, err := ParseFingerprints([]byte(`{"technologies": {"A": {"cats": "x"}}}`)); err == nil {
+		t.Error("expected an error for invalid rules")
+	}
+}
+
+func TestCrawlerFingerprint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Server", "nginx")
+			_, _ = w.Write([]byte(`<html><a href="/a">a</a><a href="/b">b</a></html>`))
+		default:
+			w.Header().Set("Server", "nginx/1.18.0")
+			_, _ = w.Write([]byte(`<html></html>`))
+		}
+	}))
+	defer ts.Close()
+
+	site, _ := url.Parse(ts.URL)
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 2
+	cfg.Robots = false
+	cfg.Fingerprint = true
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	var found []string
+	for out := range ch {
+		if out.OutputType != "technology" {
+			continue
+		}
+		if out.Technology == nil || out.Technology.Host != site.Host {
+			t.Errorf("unexpected technology %+v", out.Technology)
+		}
+		found = append(found, out.Output)
+	}
+	// Reported without version from the first page, then once with the version
+	if len(found) != 2 || found[0] != "Nginx" || found[1] != "Nginx 1.18.0" {
+		t.Errorf("unexpected technologies %v", found)
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// Form is a HTML form with everything needed to replay it
+type Form struct {
+	// Page is the URL of the page where the form was found
+	Page    string      `json:"page"`
+	Action  string      `json:"action"`
+	Method  string      `json:"method"`
+	Enctype string      `json:"enctype"`
+	Inputs  []FormInput `json:"inputs"`
+}
+
+type FormInput struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// Options are the values of a select
+	Options []string `json:"options,omitempty"`
+}
+
+// ParseForm reads the action, method, encoding and fields of a form element
+func ParseForm(e *colly.HTMLElement) *Form {
+	form := &Form{
+		Page:    e.Request.URL.String(),
+		Action:  e.Request.URL.String(),
+		Method:  strings.ToUpper(strings.TrimSpace(e.Attr("method"))),
+		Enctype: strings.ToLower(strings.TrimSpace(e.Attr("enctype"))),
+	}
+	if action := strings.TrimSpace(e.Attr("action")); action != "" {
+		form.Action = e.Request.AbsoluteURL(action)
+	}
+	if form.Method != "POST" {
+		form.Method = "GET"
+	}
+	if form.Enctype == "" {
+		form.Enctype = "application/x-www-form-urlencoded"
+	}
+
+	e.DOM.Find("input, select, textarea, button").Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		if name == "" {
+			return
+		}
+		input := FormInput{Name: name}
+		switch goquery.NodeName(s) {
+		case "select":
+			input.Type = "select"
+			s.Find("option").Each(func(i int, o *goquery.Selection) {
+				value, ok := o.Attr("value")
+				if !ok {
+					value = strings.TrimSpace(o.Text())
+				}
+				input.Options = append(input.Options, value)
+				if _, selected := o.Attr("selected"); selected || i == 0 {
+					input.Value = value
+				}
+			})
+		case "textarea":
+			input.Type = "textarea"
+			input.Value = s.Text()
+		case "button":
+			input.Type = strings.ToLower(s.AttrOr("type", "submit"))
+			input.Value = s.AttrOr("value", "")
+		default:
+			input.Type = strings.ToLower(s.AttrOr("type", "text"))
+			input.Value = s.AttrOr("value", "")
+			if (input.Type == "checkbox" || input.Type == "radio") && input.Value == "" {
+				input.Value = "on"
+			}
+		}
+		form.Inputs = append(form.Inputs, input)
+	})
+	return form
+}
+
+// key identifies a form by its target and fields, to report the same form only once
+func (f *Form) key() string {
+	names := make([]string, 0, len(f.Inputs))
+	for _, input := range f.Inputs {
+		names = append(names, input.Name)
+	}
+	return f.Method + " " + f.Action + " " + strings.Join(names, ",")
+}
+
+// FillForm returns the values to submit a form, empty fields get a dummy value matching their type
+func FillForm(form *Form) map[string]string {
+	values := make(map[string]string)
+	for _, input := range form.Inputs {
+		if _, ok := values[input.Name]; ok {
+			continue
+		}
+		switch input.Type {
+		case "file", "reset", "image":
+			continue
+		case "hidden", "submit", "button", "select", "checkbox", "radio":
+			values[input.Name] = input.Value
+			continue
+		}
+		if input.Value != "" {
+			values[input.Name] = input.Value
+			continue
+		}
+		values[input.Name] = dummyValue(input.Type)
+	}
+	return values
+}
+
+func dummyValue(inputType string) string {
+	switch inputType {
+	case "email":
+		return "test@example.com"
+	case "number", "range":
+		return "1"
+	case "tel":
+		return "5555555555"
+	case "url":
+		return "https://example.com"
+	case "password":
+		return "Passw0rd!"
+	case "date":
+		return "2020-01-01"
+	case "datetime-local":
+		return "2020-01-01T12:00"
+	case "month":
+		return "2020-01"
+	case "week":
+		return "2020-W01"
+	case "time":
+		return "12:00"
+	case "color":
+		return "#000000"
+	}
+	return "test"
+}
+
+// submitForm fills and submits a form through the main collector.
+// POST forms are only submitted when allowed by the config.
+func (crawler *Crawler) submitForm(e *colly.HTMLElement, form *Form) {
+	if form.Method == "POST" && !crawler.config.SubmitPost {
+		return
+	}
+	if !crawler.allowedURL(crawler.C, form.Action) {
+		return
+	}
+	values := FillForm(form)
+	Logger.Debugf("Submitting form: %s %s", form.Method, form.Action)
+
+	var err error
+	switch {
+	case form.Method == "GET":
+		u, parseErr := url.Parse(form.Action)
+		if parseErr != nil {
+			return
+		}
+		query := u.Query()
+		for k, v := range values {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		err = e.Request.Visit(u.String())
+	case form.Enctype == "multipart/form-data":
+		data := make(map[string][]byte)
+		for k, v := range values {
+			data[k] = []byte(v)
+		}
+		err = e.Request.PostMultipart(form.Action, data)
+	default:
+		err = e.Request.Post(form.Action, values)
+	}
+	if err != nil {
+		Logger.Debugf("Failed to submit form %s: %s", form.Action, err)
+	}
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const formFixture = `<html><body>
+<form action="/search" method="post" enctype="multipart/form-data">
+	<input type="hidden" name="csrf" value="token123">
+	<input name="q">
+	<select name="sort"><option value="asc">Ascending</option><option value="desc" selected>Descending</option></select>
+	<textarea name="comment">hello</textarea>
+	<input type="checkbox" name="exact">
+	<button type="submit" name="go" value="1">Go</button>
+</form>
+</body></html>`
+
+func TestParseForm(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, formFixture)
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	var form *Form
+	for out := range ch {
+		if out.OutputType == "form" {
+			form = out.Form
+		}
+	}
+	if form == nil {
+		t.Fatal("form not found")
+	}
+
+	want := &Form{
+		Page:    ts.URL,
+		Action:  ts.URL + "/search",
+		Method:  "POST",
+		Enctype: "multipart/form-data",
+		Inputs: []FormInput{
+			{Name: "csrf", Type: "hidden", Value: "token123"},
+			{Name: "q", Type: "text"},
+			{Name: "sort", Type: "select", Value: "desc", Options: []string{"asc", "desc"}},
+			{Name: "comment", Type: "textarea", Value: "hello"},
+			{Name: "exact", Type: "checkbox", Value: "on"},
+			{Name: "go", Type: "submit", Value: "1"},
+		},
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("ParseForm() = %+v, want %+v", form, want)
+	}
+}
+
+func TestSubmitForms(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Form.Encode())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<form action="/search"><input name="q"><input type="email" name="mail"></form>
+<form action="/comment" method="post"><input name="body"></form>
+<form action="/logout" method="post"><input type="hidden" name="all" value="1"></form>`)
+		}
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	crawl := func(submitPost bool) []string {
+		requests = nil
+		cfg := NewCrawlerConfig()
+		cfg.MaxDepth = 2
+		cfg.Robots = false
+		cfg.SubmitForms = true
+		cfg.SubmitPost = submitPost
+		cfg.Blacklist = "/logout"
+		cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+		crawler, err := NewCrawler(site, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crawler.Run()
+		sort.Strings(requests)
+		return requests
+	}
+
+	want := []string{"GET / ", "GET /search mail=test%40example.com&q=test"}
+	if got := crawl(false); !reflect.DeepEqual(got, want) {
+		t.Errorf("GET only: got %v, want %v", got, want)
+	}
+	want = []string{"GET / ", "GET /search mail=test%40example.com&q=test", "POST /comment body=test"}
+	if got := crawl(true); !reflect.DeepEqual(got, want) {
+		t.Errorf("with POST: got %v, want %v", got, want)
+	}
+}
@@ -7,7 +7,10 @@ import (
 
 const SUBRE = `(?i)(([a-zA-Z0-9]{1}|[_a-zA-Z0-9]{1}[_a-zA-Z0-9-]{0,61}[a-zA-Z0-9]{1})[.]{1})+`
 
-var AWSS3 = regexp.MustCompile(`(?i)[a-z0-9.-]+\.s3\.amazonaws\.com|[a-z0-9.-]+\.s3-[a-z0-9-]\.amazonaws\.com|[a-z0-9.-]+\.s3-website[.-](eu|ap|us|ca|sa|cn)|//s3\.amazonaws\.com/[a-z0-9._-]+|//s3-[a-z0-9-]+\.amazonaws\.com/[a-z0-9._-]+`)
+// AWSS3 matches the S3 hostnames and path style URLs.
+//
+// Deprecated: GetCloudAssets finds the buckets of every provider, with their name and region.
+var AWSS3 = regexp.MustCompile(`(?i)[a-z0-9.-]+\.s3\.amazonaws\.com|[a-z0-9.-]+\.s3-[a-z0-9-]+\.amazonaws\.com|[a-z0-9.-]+\.s3-website[.-](eu|ap|us|ca|sa|cn)|//s3\.amazonaws\.com/[a-z0-9._-]+|//s3-[a-z0-9-]+\.amazonaws\.com/[a-z0-9._-]+`)
 
 // SubdomainRegex returns a Regexp object initialized to match
 // subdomain names that end with the domain provided by the parameter.
@@ -26,6 +29,9 @@ func GetSubdomains(source, domain string) []string {
 	return subs
 }
 
+// GetAWSS3 returns the S3 matches of source.
+//
+// Deprecated: use GetCloudAssets.
 func GetAWSS3(source string) []string {
 	var aws []string
 	for _, match := range AWSS3.FindAllStringSubmatch(source, -1) {
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// HostLimit overrides the concurrency and delay of the hosts matching a glob.
+// The glob is matched against the host and port of the URLs, like *.cdn.example.com
+// or example.com:8443. The concurrency of a glob is shared by all of its hosts.
+type HostLimit struct {
+	Host string `yaml:"host"`
+	// Concurrency is the max number of parallel requests, the default one when 0
+	Concurrency int `yaml:"concurrency"`
+	// Delay and RandomDelay replace the default ones, no delay when not set
+	Delay       time.Duration `yaml:"delay"`
+	RandomDelay time.Duration `yaml:"random_delay"`
+}
+
+func (h HostLimit) limitRule() *colly.LimitRule {
+	return &colly.LimitRule{
+		DomainGlob:  h.Host,
+		Parallelism: h.Concurrency,
+		Delay:       h.Delay,
+		RandomDelay: h.RandomDelay,
+	}
+}
+
+func (h HostLimit) validate() error {
+	if h.Host == "" {
+		return fmt.Errorf("host limit without host")
+	}
+	if h.Concurrency < 0 || h.Delay < 0 || h.RandomDelay < 0 {
+		return fmt.Errorf("host limit of %s: negative value", h.Host)
+	}
+	if err := h.limitRule().Init(); err != nil {
+		return fmt.Errorf("host limit of %s: invalid glob: %s", h.Host, err)
+	}
+	return nil
+}
+
+// ParseHostLimit parses a host limit written as a glob followed by its settings:
+//
+//	*.cdn.example.com,concurrency=20,delay=0s
+//	app.example.com,concurrency=1,delay=2s,random-delay=1s
+func ParseHostLimit(s string) (HostLimit, error) {
+	fields := strings.Split(s, ",")
+	limit := HostLimit{Host: strings.TrimSpace(fields[0])}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return limit, fmt.Errorf("invalid host limit %q: expected key=value, got %q", s, field)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "concurrency":
+			limit.Concurrency, err = strconv.Atoi(value)
+		case "delay":
+			limit.Delay, err = time.ParseDuration(value)
+		case "random-delay":
+			limit.RandomDelay, err = time.ParseDuration(value)
+		default:
+			return limit, fmt.Errorf("invalid host limit %q: unknown setting %s, expected concurrency, delay or random-delay", s, key)
+		}
+		if err != nil {
+			return limit, fmt.Errorf("invalid host limit %q: invalid %s %q", s, key, value)
+		}
+	}
+	if err := limit.validate(); err != nil {
+		return limit, err
+	}
+	return limit, nil
+}
+
+// LoadHostLimits reads host limits from a YAML file:
+//
+//   - host: "*.cdn.example.com"
+//     concurrency: 20
+//   - host: app.example.com
+//     concurrency: 1
+//     delay: 2s
+func LoadHostLimits(filename string) ([]HostLimit, error) {
+	data, err := ioutil.ReadFile(NormalizePath(filename))
+	if err != nil {
+		return nil, err
+	}
+	var limits []HostLimit
+	if err := yaml.UnmarshalStrict(data, &limits); err != nil {
+		return nil, fmt.Errorf("failed to parse host limits %s: %s", filename, err)
+	}
+	for _, limit := range limits {
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+	return limits, nil
+}
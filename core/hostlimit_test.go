@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHostLimit(t *testing.T) {
+	limit, err := ParseHostLimit("*.cdn.example.com, concurrency=20, delay=500ms, random-delay=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := HostLimit{Host: "*.cdn.example.com", Concurrency: 20, Delay: 500 * time.Millisecond, RandomDelay: time.Second}
+	if limit != want {
+		t.Errorf("got %+v, want %+v", limit, want)
+	}
+
+	for _, s := range []string{
+		"",
+		"example.com,concurrency",
+		"example.com,concurrency=many",
+		"example.com,delay=2",
+		"example.com,speed=10",
+		"example.com,concurrency=-1",
+		"[example.com",
+	} {
+		if _, err := ParseHostLimit(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestLoadHostLimits(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "limits.yaml")
+	err := ioutil.WriteFile(filename, []byte(`
+- host: "*.cdn.example.com"
+  concurrency: 20
+- host: app.example.com
+  concurrency: 1
+  delay: 2s
+  random_delay: 500ms
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits, err := LoadHostLimits(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HostLimit{
+		{Host: "*.cdn.example.com", Concurrency: 20},
+		{Host: "app.example.com", Concurrency: 1, Delay: 2 * time.Second, RandomDelay: 500 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(limits, want) {
+		t.Errorf("got %+v, want %+v", limits, want)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("- host: example.com\n  parallelism: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHostLimits(filename); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+}
+
+func TestHostLimitsCrawl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a><a href="/c">c</a>`)
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	crawl := func(limits ...HostLimit) time.Duration {
+		cfg := NewCrawlerConfig()
+		cfg.Robots = false
+		cfg.Delay = 150 * time.Millisecond
+		cfg.HostLimits = limits
+		cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+		crawler, err := NewCrawler(site, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		crawler.Run()
+		return time.Since(start)
+	}
+
+	// The first matching limit wins over the default delay
+	if d := crawl(HostLimit{Host: site.Host}, HostLimit{Host: "*", Delay: time.Second}); d >= 150*time.Millisecond {
+		t.Errorf("host limit not applied, the crawl took %s", d)
+	}
+	if d := crawl(HostLimit{Host: "other.com", Concurrency: 10}); d < 150*time.Millisecond {
+		t.Errorf("default delay not applied, the crawl took %s", d)
+	}
+}
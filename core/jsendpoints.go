@@ -0,0 +1,355 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/js"
+)
+
+// JSEndpoint is an endpoint referenced by a JavaScript source.
+// Method is the HTTP method of the call sending the request, when known.
+type JSEndpoint struct {
+	URL    string
+	Method string
+}
+
+var httpMethods = map[string]bool{
+	"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true, "HEAD": true, "OPTIONS": true,
+}
+
+// JSEndpoints parses a JavaScript source and returns the endpoints it references, in order:
+// string and template literals, concatenations of constants, and the URLs of the
+// fetch, XMLHttpRequest.open, axios, jQuery and similar calls with their HTTP method.
+// The unknown parts of a template or concatenation are written as {name}.
+func JSEndpoints(source string) ([]JSEndpoint, error) {
+	ast, err := js.Parse(parse.NewInputString(source), js.Options{})
+	if err != nil {
+		return nil, err
+	}
+	e := &endpointExtractor{consts: make(map[*js.Var]js.IExpr), index: make(map[string]int)}
+	js.Walk(&constCollector{e}, ast)
+	js.Walk(e, ast)
+	return e.endpoints, nil
+}
+
+type endpointExtractor struct {
+	// consts are the initial values of the variables, used to resolve concatenations
+	consts    map[*js.Var]js.IExpr
+	endpoints []JSEndpoint
+	index     map[string]int
+}
+
+// add records an endpoint, the method fills the one of an endpoint already found without it
+func (e *endpointExtractor) add(u, method string) {
+	u = strings.TrimSpace(u)
+	if u == "" {
+		return
+	}
+	if i, ok := e.index[u]; ok {
+		if e.endpoints[i].Method == "" {
+			e.endpoints[i].Method = method
+		}
+		return
+	}
+	e.index[u] = len(e.endpoints)
+	e.endpoints = append(e.endpoints, JSEndpoint{URL: u, Method: method})
+}
+
+// constCollector records the variables declared with an initial value
+type constCollector struct {
+	e *endpointExtractor
+}
+
+func (c *constCollector) Enter(n js.INode) js.IVisitor {
+	if decl, ok := n.(*js.VarDecl); ok {
+		for _, item := range decl.List {
+			if v, ok := item.Binding.(*js.Var); ok && item.Default != nil {
+				c.e.consts[resolveVar(v)] = item.Default
+			}
+		}
+	}
+	return c
+}
+
+func (c *constCollector) Exit(js.INode) {}
+
+func resolveVar(v *js.Var) *js.Var {
+	for v.Link != nil {
+		v = v.Link
+	}
+	return v
+}
+
+func (e *endpointExtractor) Enter(n js.INode) js.IVisitor {
+	switch n := n.(type) {
+	case *js.CallExpr:
+		e.call(calleeName(n.X), n.Args.List)
+	case *js.NewExpr:
+		if n.Args != nil && calleeName(n.X) == "Request" {
+			e.call("fetch", n.Args.List)
+		}
+	case *js.BinaryExpr:
+		if n.Op == js.AddToken {
+			if s, ok := e.eval(n, 0); ok {
+				if looksLikeEndpoint(s) {
+					e.add(s, "")
+				}
+				// The parts are not endpoints on their own
+				return nil
+			}
+		}
+	case *js.TemplateExpr:
+		if n.Tag == nil {
+			if s, ok := e.eval(n, 0); ok && looksLikeEndpoint(s) {
+				e.add(s, "")
+			}
+		}
+	case *js.LiteralExpr:
+		if n.TokenType == js.StringToken {
+			if s := jsUnquote(n.Data); looksLikeEndpoint(s) {
+				e.add(s, "")
+			}
+		}
+	}
+	return e
+}
+
+func (e *endpointExtractor) Exit(js.INode) {}
+
+// call records the URL of the requests sent by a call
+func (e *endpointExtractor) call(callee string, args []js.Arg) {
+	if len(args) == 0 {
+		return
+	}
+	name := callee
+	if i := strings.LastIndex(callee, "."); i >= 0 {
+		name = callee[i+1:]
+	}
+	arg := func(i int) js.IExpr {
+		if i < len(args) {
+			return args[i].Value
+		}
+		return nil
+	}
+
+	switch {
+	case name == "fetch":
+		// fetch(url, {method: "POST"})
+		e.request(arg(0), e.property(arg(1), "method"), "GET", false)
+	case callee == "axios" || callee == "axios.request" || name == "ajax":
+		// axios(url, config), axios({url, method}) or $.ajax({url, type})
+		if obj, ok := arg(0).(*js.ObjectExpr); ok {
+			method := e.property(obj, "method")
+			if method == "" {
+				method = e.property(obj, "type")
+			}
+			e.request(propertyValue(obj, "url"), method, "GET", false)
+		} else {
+			e.request(arg(0), e.property(arg(1), "method"), "GET", false)
+		}
+	case name == "open" && len(args) >= 2:
+		// XMLHttpRequest.open(method, url)
+		if method, ok := e.eval(arg(0), 0); ok && httpMethods[strings.ToUpper(method)] {
+			e.request(arg(1), method, "", false)
+		}
+	case name == "getJSON" || name == "load":
+		e.request(arg(0), "", "GET", true)
+	case name == "sendBeacon":
+		e.request(arg(0), "", "POST", true)
+	case httpMethods[strings.ToUpper(name)] && strings.Contains(callee, "."):
+		// axios.get, $.post, this.http.put...
+		e.request(arg(0), "", strings.ToUpper(name), true)
+	}
+}
+
+// request records the URL of a call, strict requires it to look like an endpoint
+// for the calls which may not send requests at all, like map.get(key)
+func (e *endpointExtractor) request(urlExpr js.IExpr, method, defaultMethod string, strict bool) {
+	u, ok := e.eval(urlExpr, 0)
+	if !ok || strings.ContainsAny(u, " \t\r\n\"'<>") || (strict && !looksLikeEndpoint(u)) {
+		return
+	}
+	if method == "" {
+		method = defaultMethod
+	}
+	e.add(u, strings.ToUpper(method))
+}
+
+// property evaluates a property of an object literal
+func (e *endpointExtractor) property(expr js.IExpr, name string) string {
+	s, _ := e.eval(propertyValue(expr, name), 0)
+	return s
+}
+
+func propertyValue(expr js.IExpr, name string) js.IExpr {
+	obj, ok := expr.(*js.ObjectExpr)
+	if !ok {
+		return nil
+	}
+	for _, prop := range obj.List {
+		if prop.Name == nil || prop.Name.IsComputed() {
+			continue
+		}
+		key := string(prop.Name.Literal.Data)
+		if prop.Name.Literal.TokenType == js.StringToken {
+			key = jsUnquote(prop.Name.Literal.Data)
+		}
+		if key == name {
+			return prop.Value
+		}
+	}
+	return nil
+}
+
+// eval computes the string value of an expression. The unknown parts of a concatenation
+// are written as {name}, ok is false when no part of the expression is a string.
+func (e *endpointExtractor) eval(expr js.IExpr, depth int) (string, bool) {
+	// Constants may refer to each other, but not endlessly
+	if depth > 10 {
+		return "", false
+	}
+	switch n := expr.(type) {
+	case *js.LiteralExpr:
+		switch n.TokenType {
+		case js.StringToken:
+			return jsUnquote(n.Data), true
+		case js.DecimalToken, js.IntegerToken:
+			return string(n.Data), false
+		}
+	case *js.TemplateExpr:
+		if n.Tag != nil {
+			return "", false
+		}
+		var sb strings.Builder
+		for _, part := range n.List {
+			sb.WriteString(templateText(part.Value))
+			s, _ := e.eval(part.Expr, depth+1)
+			if s == "" {
+				s = placeholder(part.Expr)
+			}
+			sb.WriteString(s)
+		}
+		sb.WriteString(templateText(n.Tail))
+		return sb.String(), true
+	case *js.BinaryExpr:
+		if n.Op != js.AddToken {
+			return "", false
+		}
+		x, okX := e.eval(n.X, depth+1)
+		y, okY := e.eval(n.Y, depth+1)
+		if !okX && !okY {
+			return "", false
+		}
+		if x == "" {
+			x = placeholder(n.X)
+		}
+		if y == "" {
+			y = placeholder(n.Y)
+		}
+		return x + y, true
+	case *js.GroupExpr:
+		return e.eval(n.X, depth+1)
+	case *js.Var:
+		if value, ok := e.consts[resolveVar(n)]; ok {
+			return e.eval(value, depth+1)
+		}
+	}
+	return "", false
+}
+
+// placeholder stands for an unknown part of a string
+func placeholder(expr js.IExpr) string {
+	switch n := expr.(type) {
+	case *js.Var:
+		return "{" + string(n.Name()) + "}"
+	case *js.DotExpr:
+		return "{" + string(n.Y.Data) + "}"
+	}
+	return "{param}"
+}
+
+// calleeName returns the dotted name of a called function, like axios.get
+func calleeName(expr js.IExpr) string {
+	switch n := expr.(type) {
+	case *js.Var:
+		return string(n.Name())
+	case *js.DotExpr:
+		if x := calleeName(n.X); x != "" {
+			return x + "." + string(n.Y.Data)
+		}
+		return string(n.Y.Data)
+	case *js.LiteralExpr:
+		return string(n.Data)
+	case *js.GroupExpr:
+		return calleeName(n.X)
+	}
+	return ""
+}
+
+// templateText strips the backquotes and ${ } delimiters of a template literal part
+func templateText(data []byte) string {
+	s := string(data)
+	s = strings.TrimPrefix(s, "`")
+	s = strings.TrimPrefix(s, "}")
+	s = strings.TrimSuffix(s, "${")
+	s = strings.TrimSuffix(s, "`")
+	return jsUnescape(s)
+}
+
+// jsUnquote returns the value of a string literal
+func jsUnquote(data []byte) string {
+	s := string(data)
+	if len(s) >= 2 {
+		s = s[1 : len(s)-1]
+	}
+	return jsUnescape(s)
+}
+
+func jsUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'x', 'u':
+			size := 2
+			if c == 'u' {
+				size = 4
+			}
+			if i+size < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32); err == nil {
+					sb.WriteRune(rune(r))
+					i += size
+					continue
+				}
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// looksLikeEndpoint applies the LinkFinder regex to a whole string value
+func looksLikeEndpoint(s string) bool {
+	if s == "" || len(s) > 2048 {
+		return false
+	}
+	m := linkFinderRegex.FindStringSubmatch(`"` + s + `"`)
+	return m != nil && m[1] == s
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const jsEndpointsFixture = `
+const API = "/api/v2";
+var base = API + "/users";
+let version = 3;
+
+function load(id) {
+	fetch(base + "/" + id + "/profile");
+	fetch("/api/orders", {method: "post", body: JSON.stringify({})});
+	axios.post(` + "`${API}/items/${id}?full=1`" + `, {});
+	axios.get("/api/health");
+	axios({url: "/api/bulk", method: "PUT"});
+	$.ajax({url: "/legacy/save.php", type: "POST"});
+	var xhr = new XMLHttpRequest();
+	xhr.open("DELETE", "/api/sessions/" + id);
+	navigator.sendBeacon("/collect", "x");
+	cache.get(id);
+	var header = {"Content-Type": "application/json"};
+	var label = "Hello world";
+	return "/static/app.css";
+}
+`
+
+func TestJSEndpoints(t *testing.T) {
+	endpoints, err := JSEndpoints(jsEndpointsFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, endpoint := range endpoints {
+		got[endpoint.URL] = endpoint.Method
+	}
+
+	want := map[string]string{
+		"/api/v2/users/{id}/profile": "GET",
+		"/api/orders":                "POST",
+		"/api/v2/items/{id}?full=1":  "POST",
+		"/api/health":                "GET",
+		"/api/bulk":                  "PUT",
+		"/legacy/save.php":           "POST",
+		"/api/sessions/{id}":         "DELETE",
+		"/collect":                   "POST",
+		"/static/app.css":            "",
+	}
+	for u, method := range want {
+		if m, ok := got[u]; !ok {
+			t.Errorf("endpoint %s not found in %v", u, endpoints)
+		} else if m != method {
+			t.Errorf("endpoint %s: got method %q, want %q", u, m, method)
+		}
+	}
+	for _, noise := range []string{"Hello world", "Content-Type", "post", "DELETE"} {
+		if _, ok := got[noise]; ok {
+			t.Errorf("%q is not an endpoint", noise)
+		}
+	}
+}
+
+func TestJSEndpointsEscapes(t *testing.T) {
+	endpoints, err := JSEndpoints(`var u = "https://example.com\x2Fapi\/login";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].URL != "https://example.com/api/login" {
+		t.Errorf("unexpected endpoints %v", endpoints)
+	}
+}
+
+func TestJSEndpointsInvalid(t *testing.T) {
+	if _, err := JSEndpoints(`{"url": "/api/x"} }}`); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestCrawlerJSEndpoints(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = r.Method
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><script src="/app.js"></script></html>`))
+		case "/app.js":
+			_, _ = w.Write([]byte(`var api = "/api"; fetch(api + "/items"); fetch(api + "/orders", {method: "POST"});`))
+		}
+	}))
+	defer ts.Close()
+
+	site, _ := url.Parse(ts.URL)
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 3
+	cfg.Robots = false
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]string)
+	for out := range ch {
+		if out.OutputType == "linkfinder" && strings.HasPrefix(out.Output, "/api") {
+			found[out.Output] = out.Method
+		}
+	}
+	if found["/api/items"] != "GET" || found["/api/orders"] != "POST" {
+		t.Errorf("unexpected linkfinder results %v", found)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := requested["/api/orders"]; ok {
+		t.Error("POST endpoint visited")
+	}
+}
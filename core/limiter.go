@@ -0,0 +1,193 @@
+package core
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	// DefaultThrottleRetries is how many times a throttled request is queued again
+	DefaultThrottleRetries = 3
+	// DefaultMaxThrottleDelay caps the delay between the requests of a throttled host
+	DefaultMaxThrottleDelay = 30 * time.Second
+)
+
+// HostLimiter adapts the pace of the requests to each host.
+// A host answering 429 or 503 gets twice as slow and its Retry-After is honored,
+// a host answering much slower than usual gets slower too.
+// After a run of healthy answers the pace goes back up, to no delay at all.
+// It only adds to the Delay of the LimitRule, which stays the floor.
+type HostLimiter struct {
+	// MaxDelay caps the delay between two requests to a host
+	MaxDelay time.Duration
+	// Healthy is the number of healthy answers in a row needed to speed up
+	Healthy int
+
+	next  http.RoundTripper
+	mu    sync.Mutex
+	hosts map[string]*hostRate
+}
+
+// hostRate is the pace of the requests to a host
+type hostRate struct {
+	delay time.Duration
+	// next is when the next request may be sent
+	next    time.Time
+	healthy int
+	// latency is the moving average of the response time
+	latency time.Duration
+	samples int
+}
+
+// NewHostLimiter creates a limiter sending its requests with next
+func NewHostLimiter(next http.RoundTripper) *HostLimiter {
+	return &HostLimiter{
+		MaxDelay: DefaultMaxThrottleDelay,
+		Healthy:  10,
+		next:     next,
+		hosts:    make(map[string]*hostRate),
+	}
+}
+
+func (l *HostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if wait := l.reserve(host); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	start := time.Now()
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	l.observe(host, resp, time.Since(start))
+	return resp, nil
+}
+
+// Delay returns the current delay between two requests to host
+func (l *HostLimiter) Delay(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate, ok := l.hosts[host]; ok {
+		return rate.delay
+	}
+	return 0
+}
+
+// reserve books the next slot of host and returns how long to wait for it
+func (l *HostLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rate := l.rate(host)
+	now := time.Now()
+	slot := rate.next
+	if slot.Before(now) {
+		slot = now
+	}
+	rate.next = slot.Add(rate.delay)
+	return slot.Sub(now)
+}
+
+func (l *HostLimiter) rate(host string) *hostRate {
+	rate, ok := l.hosts[host]
+	if !ok {
+		rate = &hostRate{}
+		l.hosts[host] = rate
+	}
+	return rate
+}
+
+// observe adapts the pace of host to an answer
+func (l *HostLimiter) observe(host string, resp *http.Response, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rate := l.rate(host)
+
+	if throttled(resp.StatusCode) {
+		rate.healthy = 0
+		l.slowDown(host, rate, 2, resp.Status)
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if retryAfter > l.MaxDelay {
+				retryAfter = l.MaxDelay
+			}
+			if pause := time.Now().Add(retryAfter); pause.After(rate.next) {
+				rate.next = pause
+				Logger.Warnf("%s asked to retry after %s, pausing", host, retryAfter)
+			}
+		}
+		return
+	}
+
+	// Much slower answers than usual are the first sign of an overloaded host
+	slow := rate.samples >= 5 && latency > time.Second && latency > 4*rate.latency
+	if rate.samples == 0 {
+		rate.latency = latency
+	} else {
+		rate.latency = (4*rate.latency + latency) / 5
+	}
+	rate.samples++
+	if slow {
+		rate.healthy = 0
+		l.slowDown(host, rate, 1.5, "slow answer in "+latency.Round(time.Millisecond).String())
+		return
+	}
+
+	rate.healthy++
+	if rate.delay > 0 && rate.healthy >= l.Healthy {
+		rate.healthy = 0
+		rate.delay = rate.delay * 3 / 4
+		if rate.delay < 100*time.Millisecond {
+			rate.delay = 0
+		}
+		Logger.Infof("%s is healthy, speeding up to a delay of %s", host, rate.delay)
+	}
+}
+
+func (l *HostLimiter) slowDown(host string, rate *hostRate, factor float64, reason string) {
+	delay := time.Duration(float64(rate.delay) * factor)
+	if delay < 500*time.Millisecond {
+		delay = 500 * time.Millisecond
+	}
+	if delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+	if delay != rate.delay {
+		rate.delay = delay
+		Logger.Warnf("%s: %s, slowing down to a delay of %s", host, reason, delay)
+	}
+}
+
+func throttled(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// setupRetry queues the throttled requests again, the limiter delays them
+func (crawler *Crawler) setupRetry() {
+	for _, c := range []*colly.Collector{crawler.C, crawler.LinkFinderCollector} {
+		c.OnError(func(response *colly.Response, err error) {
+			if !throttled(response.StatusCode) {
+				return
+			}
+			// The context is shared with the child requests, the count is kept by URL
+			key := "throttleRetries:" + response.Request.URL.String()
+			retries, _ := response.Ctx.GetAny(key).(int)
+			if retries >= DefaultThrottleRetries {
+				Logger.Warnf("Giving up %s after %d throttled attempts", response.Request.URL, retries+1)
+				return
+			}
+			response.Ctx.Put(key, retries+1)
+			if err := response.Request.Retry(); err != nil {
+				Logger.Debugf("Failed to retry %s: %s", response.Request.URL, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubTransport struct {
+	status int
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: s.status, Header: make(http.Header), Request: req}, nil
+}
+
+func TestHostLimiter(t *testing.T) {
+	stub := &stubTransport{status: http.StatusTooManyRequests}
+	limiter := NewHostLimiter(stub)
+	limiter.MaxDelay = 4 * time.Second
+	limiter.Healthy = 2
+	send := func(host string) {
+		req, _ := http.NewRequest("GET", "http://"+host+"/", nil)
+		if _, err := limiter.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send("a")
+	if d := limiter.Delay("a"); d != 500*time.Millisecond {
+		t.Errorf("got delay %s after a 429, want 500ms", d)
+	}
+	if d := limiter.Delay("b"); d != 0 {
+		t.Errorf("other hosts must not slow down, got %s", d)
+	}
+
+	// Retry-After pauses the host
+	limiter.observe("a", &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503", Header: http.Header{"Retry-After": {"3"}}}, 0)
+	if d := limiter.Delay("a"); d != time.Second {
+		t.Errorf("got delay %s after a 503, want 1s", d)
+	}
+	if wait := limiter.reserve("a"); wait < 2*time.Second {
+		t.Errorf("Retry-After not honored, waiting %s", wait)
+	}
+
+	// The delay is capped
+	for i := 0; i < 5; i++ {
+		limiter.observe("a", &http.Response{StatusCode: http.StatusTooManyRequests, Status: "429"}, 0)
+	}
+	if d := limiter.Delay("a"); d != limiter.MaxDelay {
+		t.Errorf("got delay %s, want the max %s", d, limiter.MaxDelay)
+	}
+
+	// Healthy answers speed up again
+	for i := 0; i < 2*limiter.Healthy; i++ {
+		limiter.observe("a", &http.Response{StatusCode: http.StatusOK}, 0)
+	}
+	if d := limiter.Delay("a"); d != limiter.MaxDelay*9/16 {
+		t.Errorf("got delay %s after healthy answers, want %s", d, limiter.MaxDelay*9/16)
+	}
+}
+
+func TestThrottledRetry(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/throttled":
+			mu.Lock()
+			attempts++
+			n := attempts
+			mu.Unlock()
+			if n <= 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/throttled">throttled</a>`)
+		}
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.AdaptiveRate = true
+	cfg.MaxDepth = 2
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.limiter.MaxDelay = 10 * time.Millisecond
+	crawler.Run()
+	close(ch)
+
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+	found := false
+	for out := range ch {
+		if out.OutputType == "url" && out.Output == ts.URL+"/throttled" && out.StatusCode == 200 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("throttled URL not crawled after its retries")
+	}
+	if d := crawler.limiter.Delay(site.Host); d == 0 {
+		t.Error("the limiter did not slow down")
+	}
+}
@@ -1,215 +1,318 @@
 package core
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"os"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"gopkg.in/yaml.v2"
 )
 
-func OtherSources(domain string, includeSubs bool) []string {
-	noSubs := true
-	if includeSubs {
-		noSubs = false
-	}
-	var urls []string
+func ParseOtherSources(site *url.URL, crawler *Crawler, c *colly.Collector, wg *sync.WaitGroup) {
+	defer wg.Done()
 
-	fetchFns := []fetchFn{
-		getWaybackURLs,
-		getCommonCrawlURLs,
-		getVirusTotalURLs,
-		getOtxUrls,
+	// The sources go through the proxies of the crawler
+	client := newSourceClient(crawler.transport, crawler.config.Timeout)
+	providers := crawler.config.Providers
+	if providers == nil {
+		var err error
+		providers, err = NewProviders(crawler.config.Sources, crawler.config.SourcesConfig, client)
+		if err != nil {
+			Logger.Error(err)
+			return
+		}
 	}
 
-	var wg sync.WaitGroup
+	// Provider results are crawled as they arrive instead of being collected first
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-crawler.budget.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	urls := make(chan SourceURL, 100)
+	var results []SourceResult
+	go func() {
+		results = OtherSources(ctx, site.Hostname(), crawler.config.IncludeSubs, providers, urls)
+		close(urls)
+	}()
+
+	// No more than Concurrent URLs are queued in the collector at once,
+	// the providers wait for the crawl instead of filling the memory
+	concurrent := crawler.config.Concurrent
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	slots := make(chan struct{}, concurrent)
 
-	for _, fn := range fetchFns {
-		wUrlChan := make(chan wurl)
-		wg.Add(1)
-		fetch := fn
-		go func() {
-			defer wg.Done()
-			resp, err := fetch(domain, noSubs)
-			if err != nil {
-				return
-			}
-			for _, r := range resp {
-				wUrlChan <- r
+	for u := range urls {
+		if ctx.Err() != nil {
+			// The crawl is over, the providers are canceled and stop sending
+			Logger.Infof("Crawl stopped, skipping the other sources of %s", site.Hostname())
+			for range urls {
 			}
-		}()
+			break
+		}
+		url := strings.TrimSpace(u.URL)
+		if len(url) == 0 || crawler.urlSet.Duplicate(url) {
+			continue
+		}
 
-		go func() {
-			wg.Wait()
-			close(wUrlChan)
-		}()
+		if crawler.config.IncludeOtherSourceResult {
+			crawler.emit(SpiderOutput{
+				Source:     "other-sources",
+				OutputType: "url",
+				Output:     url,
+				Timestamp:  u.Date,
+			})
+		}
 
-		for w := range wUrlChan {
-			urls = append(urls, w.url)
+		if !crawler.allowedURL(c, url) {
+			continue
+		}
+		release, ok := acquireSourceSlot(ctx, slots)
+		if !ok {
+			continue
+		}
+		reqCtx := colly.NewContext()
+		reqCtx.Put(sourceSlotKey, release)
+		if err := c.Request("GET", url, nil, reqCtx, nil); err != nil {
+			release()
 		}
 	}
-	return Unique(urls)
-}
 
-type wurl struct {
-	date string
-	url  string
+	// The outcome of each source is reported in the crawl summary
+	for _, r := range results {
+		source := SourceSummary{Name: r.Name, URLs: r.URLs, SourceStats: client.Stats(r.Name)}
+		if r.Err != nil {
+			source.Err = r.Err.Error()
+		}
+		crawler.stats.source(source)
+	}
 }
 
-type fetchFn func(string, bool) ([]wurl, error)
-
-func getWaybackURLs(domain string, noSubs bool) ([]wurl, error) {
-	subsWildcard := "*."
-	if noSubs {
-		subsWildcard = ""
-	}
-	res, err := http.Get(
-		fmt.Sprintf("http://web.archive.org/cdx/search/cdx?url=%s%s/*&output=json&collapse=urlkey", subsWildcard, domain),
-	)
-	if err != nil {
-		return []wurl{}, err
+// sourceSlotKey is the context key of the function freeing the slot of a 3rd party URL
+const sourceSlotKey = "sourceSlot"
+
+// acquireSourceSlot waits for a free slot and returns the function freeing it,
+// it returns false when ctx is canceled first.
+func acquireSourceSlot(ctx context.Context, slots chan struct{}) (func(), bool) {
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() { <-slots })
+		}, true
+	case <-ctx.Done():
+		return nil, false
 	}
+}
 
-	raw, err := ioutil.ReadAll(res.Body)
-
-	res.Body.Close()
-	if err != nil {
-		return []wurl{}, err
+// setupSourceSlots frees the slot of a 3rd party URL once its request ends
+func (crawler *Crawler) setupSourceSlots() {
+	var pending sync.Map
+	crawler.C.OnRequest(func(r *colly.Request) {
+		release, ok := r.Ctx.GetAny(sourceSlotKey).(func())
+		if !ok {
+			return
+		}
+		// The context is shared with the child requests so it must only be used once
+		r.Ctx.Put(sourceSlotKey, nil)
+		// Aborted requests never end
+		if !crawler.allowed(crawler.C, r.URL) {
+			release()
+			return
+		}
+		pending.Store(r, release)
+	})
+	done := func(r *colly.Request) {
+		if release, ok := pending.LoadAndDelete(r); ok {
+			release.(func())()
+		}
 	}
+	crawler.C.OnScraped(func(response *colly.Response) {
+		done(response.Request)
+	})
+	crawler.C.OnError(func(response *colly.Response, err error) {
+		done(response.Request)
+	})
+}
 
-	var wrapper [][]string
-	err = json.Unmarshal(raw, &wrapper)
+// SourceResult is the outcome of a provider for the run summary
+type SourceResult struct {
+	Name string
+	URLs int
+	Err  error
+}
 
-	out := make([]wurl, 0, len(wrapper))
+// OtherSources runs every provider concurrently and sends the URLs of domain they find to urls,
+// which is left open. It returns the outcome of each provider in the same order as providers.
+// URLs are not deduplicated, the URLs found by a provider before failing are kept.
+// Once ctx is canceled the providers stop and their URLs are dropped.
+func OtherSources(ctx context.Context, domain string, includeSubs bool, providers []Provider, urls chan<- SourceURL) []SourceResult {
+	noSubs := !includeSubs
 
-	skip := true
-	for _, urls := range wrapper {
-		// The first item is always just the string "original",
-		// so we should skip the first item
-		if skip {
-			skip = false
-			continue
-		}
-		out = append(out, wurl{date: urls[1], url: urls[2]})
-	}
-
-	return out, nil
+	results := make([]SourceResult, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p Provider) {
+			defer wg.Done()
 
+			found := make(chan SourceURL)
+			done := make(chan struct{})
+			count := 0
+			go func() {
+				defer close(done)
+				for u := range found {
+					u.Date = normalizeSourceDate(u.Date)
+					select {
+					case urls <- u:
+						count++
+					case <-ctx.Done():
+					}
+				}
+			}()
+			err := p.Fetch(ctx, domain, noSubs, found)
+			close(found)
+			<-done
+
+			results[i] = SourceResult{Name: p.Name(), URLs: count, Err: err}
+			if err != nil && ctx.Err() == nil {
+				Logger.Errorf("Failed to fetch URLs from %s: %s", p.Name(), err)
+			}
+			Logger.Infof("Found %d URLs from %s", count, p.Name())
+		}(i, p)
+	}
+	wg.Wait()
+	return results
 }
 
-func getCommonCrawlURLs(domain string, noSubs bool) ([]wurl, error) {
-	subsWildcard := "*."
-	if noSubs {
-		subsWildcard = ""
+// normalizeSourceDate turns the yyyyMMddhhmmss timestamps of the CDX servers into RFC 3339
+func normalizeSourceDate(date string) string {
+	if len(date) != 14 {
+		return date
 	}
-	res, err := http.Get(
-		fmt.Sprintf("http://index.commoncrawl.org/CC-MAIN-2019-51-index?url=%s%s/*&output=json", subsWildcard, domain),
-	)
+	t, err := time.Parse("20060102150405", date)
 	if err != nil {
-		return []wurl{}, err
+		return date
 	}
+	return t.UTC().Format(time.RFC3339)
+}
 
-	defer res.Body.Close()
-	sc := bufio.NewScanner(res.Body)
-
-	out := make([]wurl, 0)
+// SourceURL is a URL found by a passive source, with the date it was seen when known
+type SourceURL struct {
+	Date string
+	URL  string
+}
 
-	for sc.Scan() {
-		wrapper := struct {
-			URL       string `json:"url"`
-			Timestamp string `json:"timestamp"`
-		}{}
-		err = json.Unmarshal([]byte(sc.Text()), &wrapper)
+// Provider is a passive source of URLs for a domain.
+// Fetch sends the URLs to results as soon as they are found and must not close it.
+// It returns early once ctx is canceled.
+type Provider interface {
+	Name() string
+	Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error
+}
 
-		if err != nil {
-			continue
-		}
+// ProviderConfig holds the settings of a provider from the sources config file.
+// BaseURL overrides the API endpoint of the provider.
+type ProviderConfig struct {
+	APIKey  string `yaml:"api_key" json:"api_key"`
+	BaseURL string `yaml:"base_url" json:"base_url"`
+	// Indexes is the number of latest CommonCrawl indexes to query
+	Indexes int `yaml:"indexes" json:"indexes"`
+	// From and To limit the captures of the archives to a date range,
+	// as a yyyyMMddhhmmss prefix like 2020 or 20200131
+	From string `yaml:"from" json:"from"`
+	To   string `yaml:"to" json:"to"`
+	// StatusCodes and MimeTypes keep only the Wayback captures matching one of them
+	StatusCodes []string `yaml:"status_codes" json:"status_codes"`
+	MimeTypes   []string `yaml:"mime_types" json:"mime_types"`
+}
 
-		out = append(out, wurl{date: wrapper.Timestamp, url: wrapper.URL})
-	}
+// ProviderFactory creates a provider from its config, sending its requests with client
+type ProviderFactory func(cfg ProviderConfig, client *SourceClient) Provider
 
-	return out, nil
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
 
+// RegisterProvider makes a provider available by name
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
 }
 
-func getVirusTotalURLs(domain string, noSubs bool) ([]wurl, error) {
-	out := make([]wurl, 0)
-
-	apiKey := os.Getenv("VT_API_KEY")
-	if apiKey == "" {
-		Logger.Warnf("You are not set VirusTotal API Key yet.")
-		return out, nil
+// ProviderNames returns the sorted names of the registered providers
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	var names []string
+	for name := range providers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	fetchURL := fmt.Sprintf(
-		"https://www.virustotal.com/vtapi/v2/domain/report?apikey=%s&domain=%s",
-		apiKey,
-		domain,
-	)
-
-	resp, err := http.Get(fetchURL)
-	if err != nil {
-		return out, err
+// NewProviders creates the named providers, or every registered provider when names is empty.
+// They share client, a direct client is used when it is nil.
+func NewProviders(names []string, configs map[string]ProviderConfig, client *SourceClient) ([]Provider, error) {
+	if client == nil {
+		var err error
+		if client, err = NewSourceClient("", 0); err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
-
-	wrapper := struct {
-		URLs []struct {
-			URL string `json:"url"`
-		} `json:"detected_urls"`
-	}{}
-
-	dec := json.NewDecoder(resp.Body)
-
-	err = dec.Decode(&wrapper)
-
-	for _, u := range wrapper.URLs {
-		out = append(out, wurl{url: u.URL})
+	if len(names) == 0 {
+		names = ProviderNames()
 	}
 
-	return out, nil
+	var result []Provider
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		providersMu.RLock()
+		factory, ok := providers[name]
+		providersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown source %q, available sources: %s", name, strings.Join(ProviderNames(), ", "))
+		}
+		result = append(result, factory(configs[name], client))
+	}
+	return result, nil
 }
 
-func getOtxUrls(domain string, noSubs bool) ([]wurl, error) {
-	var urls []wurl
-	page := 0
-	for {
-		r, err := http.Get(fmt.Sprintf("https://otx.alienvault.com/api/v1/indicators/hostname/%s/url_list?limit=50&page=%d", domain, page))
-		if err != nil {
-			return []wurl{}, err
-		}
-		bytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return []wurl{}, err
-		}
-		r.Body.Close()
-
-		wrapper := struct {
-			HasNext    bool `json:"has_next"`
-			ActualSize int  `json:"actual_size"`
-			URLList    []struct {
-				Domain   string `json:"domain"`
-				URL      string `json:"url"`
-				Hostname string `json:"hostname"`
-				Httpcode int    `json:"httpcode"`
-				PageNum  int    `json:"page_num"`
-				FullSize int    `json:"full_size"`
-				Paged    bool   `json:"paged"`
-			} `json:"url_list"`
-		}{}
-		err = json.Unmarshal(bytes, &wrapper)
-		if err != nil {
-			return []wurl{}, err
-		}
-		for _, url := range wrapper.URLList {
-			urls = append(urls, wurl{url: url.URL})
-		}
-		if !wrapper.HasNext {
-			break
-		}
-		page++
+// LoadSourcesConfig reads the API keys and settings of the providers from a YAML or JSON file:
+//
+//	virustotal:
+//	  api_key: xxx
+//	urlscan:
+//	  api_key: xxx
+func LoadSourcesConfig(filename string) (map[string]ProviderConfig, error) {
+	data, err := ioutil.ReadFile(NormalizePath(filename))
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]ProviderConfig)
+	if strings.HasSuffix(filename, ".json") {
+		err = json.Unmarshal(data, &configs)
+	} else {
+		err = yaml.Unmarshal(data, &configs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sources config %s: %s", filename, err)
 	}
-	return urls, nil
+	return configs, nil
 }
@@ -1,47 +1,549 @@
 package core
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
-var domain = "yahoo.com"
+func newProvider(t *testing.T, name string, cfg ProviderConfig) Provider {
+	client, err := NewSourceClient("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Backoff = time.Millisecond
+	providers, err := NewProviders([]string{name}, map[string]ProviderConfig{name: cfg}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return providers[0]
+}
+
+// fetchAll collects the URLs sent by a provider
+func fetchAll(p Provider, domain string) ([]SourceURL, error) {
+	results := make(chan SourceURL)
+	var urls []SourceURL
+	done := make(chan struct{})
+	go func() {
+		for u := range results {
+			urls = append(urls, u)
+		}
+		close(done)
+	}()
+	err := p.Fetch(context.Background(), domain, false, results)
+	close(results)
+	<-done
+	return urls, err
+}
+
+func TestProviders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vtapi/v2/domain/report":
+			if r.URL.Query().Get("apikey") != "vt-key" {
+				t.Errorf("virustotal: missing api key")
+			}
+			fmt.Fprint(w, `{"detected_urls": [{"url": "http://example.com/c"}]}`)
+		case "/api/v1/indicators/hostname/example.com/url_list":
+			if r.URL.Query().Get("page") == "0" {
+				fmt.Fprint(w, `{"has_next": true, "url_list": [{"url": "http://example.com/d"}]}`)
+			} else {
+				fmt.Fprint(w, `{"has_next": false, "url_list": [{"url": "http://example.com/e"}]}`)
+			}
+		case "/api/v1/search/":
+			if r.Header.Get("API-Key") != "urlscan-key" {
+				t.Errorf("urlscan: missing api key")
+			}
+			if r.URL.Query().Get("search_after") == "" {
+				fmt.Fprint(w, `{"has_more": true, "results": [{"page": {"url": "http://example.com/f"}, "task": {"time": "2020-01-01T00:00:00Z"}, "sort": [1577836800000, "abc"]}]}`)
+			} else {
+				if r.URL.Query().Get("search_after") != "1577836800000,abc" {
+					t.Errorf("urlscan: unexpected search_after %s", r.URL.Query().Get("search_after"))
+				}
+				fmt.Fprint(w, `{"has_more": false, "results": [{"page": {"url": "http://example.com/g"}, "task": {"time": "2020-01-02T00:00:00Z"}}]}`)
+			}
+		case "/api/v2/search/terms":
+			if r.Method != "POST" || r.Header.Get("api-key") != "ha-key" || r.FormValue("domain") != "example.com" {
+				t.Errorf("hybridanalysis: unexpected request")
+			}
+			fmt.Fprint(w, `{"result": [{"submit_name": "http://example.com/h", "analysis_start_time": "2020-01-01"}, {"submit_name": "sample.exe"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		apiKey string
+		want   []SourceURL
+	}{
+		{"virustotal", "vt-key", []SourceURL{{URL: "http://example.com/c"}}},
+		{"otx", "", []SourceURL{{URL: "http://example.com/d"}, {URL: "http://example.com/e"}}},
+		{"urlscan", "urlscan-key", []SourceURL{{Date: "2020-01-01T00:00:00Z", URL: "http://example.com/f"}, {Date: "2020-01-02T00:00:00Z", URL: "http://example.com/g"}}},
+		{"hybridanalysis", "ha-key", []SourceURL{{Date: "2020-01-01", URL: "http://example.com/h"}}},
+	}
+	for _, tt := range tests {
+		p := newProvider(t, tt.name, ProviderConfig{APIKey: tt.apiKey, BaseURL: ts.URL})
+		got, err := fetchAll(p, "example.com")
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWaybackProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("url") != "*.example.com/*" || query.Get("from") != "2020" || query.Get("to") != "20211231" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		filters := query["filter"]
+		if !reflect.DeepEqual(filters, []string{"statuscode:(200|301)", `mimetype:(text/html|application/ld\+json)`}) {
+			t.Errorf("unexpected filters %v", filters)
+		}
+		switch query.Get("resumeKey") {
+		case "":
+			fmt.Fprint(w, `[["timestamp","original"],
+["20200101000000","http://example.com/a"],
+[],
+["com%2Cexample%29%2Fa+20200101000000"]]`)
+		case "com%2Cexample%29%2Fa+20200101000000":
+			fmt.Fprint(w, `[["timestamp","original"],
+["20210101000000","http://example.com/b"]]`)
+		default:
+			t.Errorf("unexpected resume key %s", query.Get("resumeKey"))
+		}
+	}))
+	defer ts.Close()
+
+	p := newProvider(t, "wayback", ProviderConfig{
+		BaseURL:     ts.URL,
+		From:        "2020",
+		To:          "20211231",
+		StatusCodes: []string{"200", "301"},
+		MimeTypes:   []string{"text/html", "application/ld+json"},
+	})
+	got, err := fetchAll(p, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SourceURL{
+		{Date: "20200101000000", URL: "http://example.com/a"},
+		{Date: "20210101000000", URL: "http://example.com/b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCommonCrawlProvider(t *testing.T) {
+	var mu sync.Mutex
+	queried := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queried[r.URL.Path] = true
+		mu.Unlock()
+		query := r.URL.Query()
+		if r.URL.Path != "/collinfo.json" && query.Get("url") != "*.example.com/*" {
+			t.Errorf("%s: unexpected query %s", r.URL.Path, r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/collinfo.json":
+			fmt.Fprintf(w, `[
+				{"id": "CC-MAIN-2024-10", "cdx-api": "http://%s/CC-MAIN-2024-10-index"},
+				{"id": "CC-MAIN-2023-50"},
+				{"id": "CC-MAIN-2023-40"},
+				{"id": "CC-MAIN-2019-51"}
+			]`, r.Host)
+		case "/CC-MAIN-2024-10-index":
+			switch {
+			case query.Get("showNumPages") == "true":
+				fmt.Fprint(w, `{"pages": 2, "pageSize": 5, "blocks": 7}`)
+			case query.Get("page") == "0":
+				fmt.Fprintln(w, `{"url": "http://example.com/a", "timestamp": "20240301000000"}`)
+				fmt.Fprintln(w, `not json`)
+			case query.Get("page") == "1":
+				fmt.Fprintln(w, `{"url": "http://example.com/b", "timestamp": "20240302000000"}`)
+			default:
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+		case "/CC-MAIN-2023-50-index":
+			switch {
+			case query.Get("showNumPages") == "true":
+				fmt.Fprint(w, `{"pages": 1, "pageSize": 5, "blocks": 1}`)
+			case query.Get("page") == "0":
+				fmt.Fprintln(w, `{"url": "http://example.com/a", "timestamp": "20231201000000"}`)
+				fmt.Fprintln(w, `{"url": "http://example.com/c", "timestamp": "20231202000000"}`)
+			}
+		case "/CC-MAIN-2023-40-index":
+			http.Error(w, "No Captures found", http.StatusNotFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	p := newProvider(t, "commoncrawl", ProviderConfig{BaseURL: ts.URL, Indexes: 3})
+	got, err := fetchAll(p, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The newest index comes first
+	want := []SourceURL{
+		{Date: "20240301000000", URL: "http://example.com/a"},
+		{Date: "20240302000000", URL: "http://example.com/b"},
+		{Date: "20231201000000", URL: "http://example.com/a"},
+		{Date: "20231202000000", URL: "http://example.com/c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if queried["/CC-MAIN-2019-51-index"] {
+		t.Error("queried an index older than the latest 3")
+	}
+}
+
+func TestOtxKeepsPagesOnError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "0" {
+			fmt.Fprint(w, `{"has_next": true, "url_list": [{"url": "http://example.com/d"}]}`)
+			return
+		}
+		http.Error(w, "oops", http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	p := newProvider(t, "otx", ProviderConfig{BaseURL: ts.URL})
+	got, err := fetchAll(p, "example.com")
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if want := []SourceURL{{URL: "http://example.com/d"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProviderWithoutAPIKey(t *testing.T) {
+	os.Unsetenv("VT_API_KEY")
+	for _, name := range []string{"virustotal", "hybridanalysis"} {
+		// An unreachable base URL makes sure no request is sent
+		p := newProvider(t, name, ProviderConfig{BaseURL: "http://127.0.0.1:1"})
+		got, err := fetchAll(p, "example.com")
+		if err != nil || len(got) != 0 {
+			t.Errorf("%s: got %v, %v, want no result", name, got, err)
+		}
+	}
+}
+
+type staticProvider struct {
+	name string
+	urls []SourceURL
+	err  error
+}
+
+func (p *staticProvider) Name() string {
+	return p.name
+}
+
+func (p *staticProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	for _, u := range p.urls {
+		results <- u
+	}
+	return p.err
+}
+
+var errFetch = errors.New("page 2: unexpected status 500")
 
 func TestOtherSources(t *testing.T) {
-	urls := OtherSources(domain, false)
-	t.Log(len(urls))
-	t.Log(urls)
+	providers := []Provider{
+		&staticProvider{"a", []SourceURL{{URL: "http://example.com/1"}, {Date: "20200101000000", URL: "http://example.com/2"}}, nil},
+		&staticProvider{"b", []SourceURL{{Date: "2021-01-01T00:00:00Z", URL: "http://example.com/2"}, {URL: "http://example.com/3"}}, errFetch},
+	}
+	ch := make(chan SourceURL, 10)
+	results := OtherSources(context.Background(), "example.com", false, providers, ch)
+	close(ch)
+	wantResults := []SourceResult{{Name: "a", URLs: 2}, {Name: "b", URLs: 2, Err: errFetch}}
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("got results %v, want %v", results, wantResults)
+	}
+
+	var urls []SourceURL
+	for u := range ch {
+		urls = append(urls, u)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		if urls[i].URL == urls[j].URL {
+			return urls[i].Date < urls[j].Date
+		}
+		return urls[i].URL < urls[j].URL
+	})
+	want := []SourceURL{
+		{URL: "http://example.com/1"},
+		{Date: "2020-01-01T00:00:00Z", URL: "http://example.com/2"},
+		{Date: "2021-01-01T00:00:00Z", URL: "http://example.com/2"},
+		{URL: "http://example.com/3"},
+	}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("got %v, want %v", urls, want)
+	}
 }
 
-func TestGetCommonCrawlURLs(t *testing.T) {
-	urls, err := getCommonCrawlURLs(domain, false)
+func TestOtherSourcesCrawl(t *testing.T) {
+	var mu sync.Mutex
+	visited := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.OtherSource = true
+	cfg.IncludeOtherSourceResult = true
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	cfg.Providers = []Provider{
+		&staticProvider{"a", []SourceURL{{URL: ts.URL + "/old"}, {Date: "20200101000000", URL: ts.URL + "/archived"}}, nil},
+		&staticProvider{"b", []SourceURL{{URL: ts.URL + "/archived"}}, errFetch},
+	}
+	crawler, err := NewCrawler(site, cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(len(urls))
-	t.Log(urls)
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]int)
+	for out := range ch {
+		if out.Source == "other-sources" {
+			found[out.Output]++
+		}
+	}
+	for _, path := range []string{"/old", "/archived"} {
+		if found[ts.URL+path] != 1 {
+			t.Errorf("%s reported %d times", path, found[ts.URL+path])
+		}
+		if visited[path] != 1 {
+			t.Errorf("%s crawled %d times", path, visited[path])
+		}
+	}
+
+	wantSources := []SourceSummary{{Name: "a", URLs: 2}, {Name: "b", URLs: 1, Err: errFetch.Error()}}
+	if summary := crawler.Summary(); !reflect.DeepEqual(summary.Sources, wantSources) {
+		t.Errorf("got sources %+v, want %+v", summary.Sources, wantSources)
+	}
+	if s := crawler.Summary().String(); !strings.Contains(s, "sources: a ok, 2 URLs, 0 requests, 0 retries, 0 failed requests; b failed, 1 URLs") {
+		t.Errorf("sources missing from the summary %q", s)
+	}
+}
+
+// countingProvider sends URLs until it is canceled or n are sent
+type countingProvider struct {
+	mu   sync.Mutex
+	sent int
+	n    int
+	base string
+	err  error
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	for i := 0; i < p.n; i++ {
+		select {
+		case results <- SourceURL{URL: fmt.Sprintf("%s/%d", p.base, i)}:
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.err = ctx.Err()
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+		p.mu.Lock()
+		p.sent++
+		p.mu.Unlock()
+	}
+	return nil
 }
 
-func TestGetVirusTotalURLs(t *testing.T) {
-	urls, err := getVirusTotalURLs(domain, false)
+func (p *countingProvider) count() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sent, p.err
+}
+
+func TestOtherSourcesBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			<-release
+		}
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	provider := &countingProvider{n: 500, base: ts.URL}
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.Concurrent = 2
+	cfg.OtherSource = true
+	cfg.Providers = []Provider{provider}
+	crawler, err := NewCrawler(site, cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(len(urls))
-	t.Log(urls)
+	done := make(chan struct{})
+	go func() {
+		crawler.Run()
+		close(done)
+	}()
+
+	// While the requests hang, the provider is blocked once the queues are full:
+	// the 100 URLs of the channel, the slots and the URL waiting for one of them
+	time.Sleep(300 * time.Millisecond)
+	if sent, _ := provider.count(); sent > 110 {
+		t.Errorf("%d URLs taken from the provider while the crawl is stuck", sent)
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl not done")
+	}
+	if sent, _ := provider.count(); sent != 500 {
+		t.Errorf("%d URLs sent, want 500", sent)
+	}
 }
 
-func TestGetWaybackURLs(t *testing.T) {
-	urls, err := getWaybackURLs(domain, false)
+func TestAcquireSourceSlot(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	release, ok := acquireSourceSlot(context.Background(), slots)
+	if !ok {
+		t.Fatal("free slot not acquired")
+	}
+
+	// No URL goes without a slot, however long it waits
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, ok := acquireSourceSlot(ctx, slots); ok {
+		t.Error("slot acquired twice")
+	}
+
+	release()
+	release()
+	if _, ok := acquireSourceSlot(context.Background(), slots); !ok || len(slots) != 1 {
+		t.Errorf("released slot not acquired, %d slots taken", len(slots))
+	}
+}
+
+func TestOtherSourcesStopped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	// The provider would page forever if it wasn't canceled
+	provider := &countingProvider{n: 1 << 30, base: ts.URL}
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.OtherSource = true
+	cfg.MaxRequests = 5
+	cfg.Providers = []Provider{provider}
+	crawler, err := NewCrawler(site, cfg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(len(urls))
-	t.Log(urls)
+	done := make(chan struct{})
+	go func() {
+		crawler.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl not done")
+	}
+	if _, err := provider.count(); err != context.Canceled {
+		t.Errorf("provider not canceled: %v", err)
+	}
+	if sources := crawler.Summary().Sources; len(sources) != 1 || sources[0].Name != "counting" {
+		t.Errorf("unexpected sources %+v", sources)
+	}
 }
 
-func TestGetOtxUrls(t *testing.T) {
-	urls, err := getOtxUrls(domain, false)
+func TestNewProviders(t *testing.T) {
+	providers, err := NewProviders(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != len(ProviderNames()) {
+		t.Errorf("got %d providers, want all %d", len(providers), len(ProviderNames()))
+	}
+
+	providers, err = NewProviders([]string{"Wayback", "otx"}, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(len(urls))
-	t.Log(urls)
+	if providers[0].Name() != "wayback" || providers[1].Name() != "otx" {
+		t.Errorf("got %s, %s", providers[0].Name(), providers[1].Name())
+	}
+
+	if _, err := NewProviders([]string{"nope"}, nil, nil); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+func TestLoadSourcesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := map[string]ProviderConfig{
+		"virustotal": {APIKey: "vt-key"},
+		"urlscan":    {APIKey: "urlscan-key", BaseURL: "http://localhost"},
+	}
+	files := map[string]string{
+		"sources.yaml": "virustotal:\n  api_key: vt-key\nurlscan:\n  api_key: urlscan-key\n  base_url: http://localhost\n",
+		"sources.json": `{"virustotal": {"api_key": "vt-key"}, "urlscan": {"api_key": "urlscan-key", "base_url": "http://localhost"}}`,
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadSourcesConfig(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
 }
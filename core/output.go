@@ -1,34 +1,108 @@
 package core
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 )
 
+// Output writes findings of a site to one file per result type inside a per-domain folder:
+//
+//	output/example.com/example.com_base.txt
+//	output/example.com/example.com_javascript.txt
+//	...
 type Output struct {
-	mu sync.Mutex
-	f  *os.File
+	mu     sync.Mutex
+	folder string
+	domain string
+	files  map[string]*os.File
+	closed bool
 }
 
-func NewOutput(folder, filename string) *Output {
-	outFile := filepath.Join(folder, filename)
-	f, err := os.OpenFile(outFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		Logger.Errorf("Failed to open file to write Output: %s", err)
-		os.Exit(1)
+func NewOutput(folder, domain string) (*Output, error) {
+	domainFolder := filepath.Join(folder, domain)
+	if err := os.MkdirAll(domainFolder, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create output folder: %s", err)
 	}
 	return &Output{
-		f: f,
+		folder: domainFolder,
+		domain: domain,
+		files:  make(map[string]*os.File),
+	}, nil
+}
+
+// outputFileType returns the file suffix used to store a result type
+func outputFileType(outputType string) string {
+	switch outputType {
+	case "url", "href", "raw":
+		return "base"
+	case "form", "upload-form":
+		return "form"
+	case "":
+		return "base"
 	}
+	return outputType
 }
 
-func (o *Output) WriteToFile(msg string) {
+// WriteToFile appends msg to the file of the given result type
+func (o *Output) WriteToFile(outputType string, msg string) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
-	_, _ = o.f.WriteString(msg + "\n")
+	// Findings of the requests ending after a forced shutdown are dropped
+	if o.closed {
+		return
+	}
+
+	fileType := outputFileType(outputType)
+	f, ok := o.files[fileType]
+	if !ok {
+		outFile := filepath.Join(o.folder, fmt.Sprintf("%s_%s.txt", o.domain, fileType))
+		var err error
+		f, err = os.OpenFile(outFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.ModePerm)
+		if err != nil {
+			Logger.Errorf("Failed to open file to write Output: %s", err)
+			return
+		}
+		o.files[fileType] = f
+	}
+	_, _ = f.WriteString(msg + "\n")
 }
 
+// WriteSource writes a source recovered from a source map to the sources folder,
+// name is a relative path made of the SourceMapFolder of the map and the SourcePath of the source
+func (o *Output) WriteSource(name string, content string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	outFile := filepath.Join(o.folder, "sources", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outFile), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outFile, []byte(content), 0644)
+}
+
+// WriteSummary saves the summary of the crawl next to its results
+func (o *Output) WriteSummary(summary string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	outFile := filepath.Join(o.folder, fmt.Sprintf("%s_summary.txt", o.domain))
+	return ioutil.WriteFile(outFile, []byte(summary+"\n"), 0644)
+}
+
+// Close closes the files, later writes are ignored
 func (o *Output) Close() {
-	o.f.Close()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	for fileType, f := range o.files {
+		f.Close()
+		delete(o.files, fileType)
+	}
 }
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputPerType(t *testing.T) {
+	folder := t.TempDir()
+	output, err := NewOutput(folder, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewFileSink(output, false, false)
+	sink.Write(SpiderOutput{Source: "body", OutputType: "url", StatusCode: 200, Output: "https://example.com/"})
+	sink.Write(SpiderOutput{Source: "body", OutputType: "javascript", Output: "https://example.com/app.js"})
+	sink.Write(SpiderOutput{Source: "body", OutputType: "upload-form", Output: "https://example.com/upload"})
+	_ = sink.Close()
+	// Findings arriving after the close are dropped
+	sink.Write(SpiderOutput{Source: "body", OutputType: "url", StatusCode: 200, Output: "https://example.com/late"})
+
+	files := map[string]string{
+		"example.com_base.txt":       "[url] - [code-200] - https://example.com/\n",
+		"example.com_javascript.txt": "[javascript] - https://example.com/app.js\n",
+		"example.com_form.txt":       "[upload-form] - https://example.com/upload\n",
+	}
+	for name, want := range files {
+		data, err := ioutil.ReadFile(filepath.Join(folder, "example.com", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestOutputSummary(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/about">about</a>`)
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	cfg := NewCrawlerConfig()
+	cfg.Robots = false
+	cfg.Quiet = true
+	cfg.OutputFolder = t.TempDir()
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+
+	data, err := ioutil.ReadFile(filepath.Join(cfg.OutputFolder, site.Hostname(), site.Hostname()+"_summary.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "1 pages, 1 requests, 0 errors") {
+		t.Errorf("unexpected summary %q", data)
+	}
+}
@@ -0,0 +1,540 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterProvider("wayback", func(cfg ProviderConfig, client *SourceClient) Provider {
+		return &waybackProvider{
+			client:      client,
+			baseURL:     baseURLOr(cfg.BaseURL, "http://web.archive.org"),
+			from:        cfg.From,
+			to:          cfg.To,
+			statusCodes: cfg.StatusCodes,
+			mimeTypes:   cfg.MimeTypes,
+		}
+	})
+	RegisterProvider("commoncrawl", func(cfg ProviderConfig, client *SourceClient) Provider {
+		indexes := cfg.Indexes
+		if indexes <= 0 {
+			indexes = DefaultCommonCrawlIndexes
+		}
+		return &commonCrawlProvider{
+			client:  client,
+			baseURL: baseURLOr(cfg.BaseURL, "https://index.commoncrawl.org"),
+			indexes: indexes,
+			from:    cfg.From,
+			to:      cfg.To,
+		}
+	})
+	RegisterProvider("virustotal", func(cfg ProviderConfig, client *SourceClient) Provider {
+		apiKey := cfg.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("VT_API_KEY")
+		}
+		return &virusTotalProvider{client: client, baseURL: baseURLOr(cfg.BaseURL, "https://www.virustotal.com"), apiKey: apiKey}
+	})
+	RegisterProvider("otx", func(cfg ProviderConfig, client *SourceClient) Provider {
+		return &otxProvider{client: client, baseURL: baseURLOr(cfg.BaseURL, "https://otx.alienvault.com")}
+	})
+	RegisterProvider("urlscan", func(cfg ProviderConfig, client *SourceClient) Provider {
+		return &urlScanProvider{client: client, baseURL: baseURLOr(cfg.BaseURL, "https://urlscan.io"), apiKey: cfg.APIKey}
+	})
+	RegisterProvider("hybridanalysis", func(cfg ProviderConfig, client *SourceClient) Provider {
+		return &hybridAnalysisProvider{client: client, baseURL: baseURLOr(cfg.BaseURL, "https://www.hybrid-analysis.com"), apiKey: cfg.APIKey}
+	})
+}
+
+func baseURLOr(baseURL, defaultURL string) string {
+	if baseURL == "" {
+		return defaultURL
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// waybackPageSize is the number of captures asked per CDX request
+const waybackPageSize = 10000
+
+type waybackProvider struct {
+	client      *SourceClient
+	baseURL     string
+	from        string
+	to          string
+	statusCodes []string
+	mimeTypes   []string
+}
+
+func (p *waybackProvider) Name() string {
+	return "wayback"
+}
+
+func (p *waybackProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	subsWildcard := "*."
+	if noSubs {
+		subsWildcard = ""
+	}
+	query := url.Values{}
+	query.Set("url", subsWildcard+domain+"/*")
+	query.Set("output", "json")
+	query.Set("fl", "timestamp,original")
+	query.Set("collapse", "urlkey")
+	query.Set("limit", strconv.Itoa(waybackPageSize))
+	query.Set("showResumeKey", "true")
+	if p.from != "" {
+		query.Set("from", p.from)
+	}
+	if p.to != "" {
+		query.Set("to", p.to)
+	}
+	if filter := cdxFilter("statuscode", p.statusCodes); filter != "" {
+		query.Add("filter", filter)
+	}
+	if filter := cdxFilter("mimetype", p.mimeTypes); filter != "" {
+		query.Add("filter", filter)
+	}
+
+	for {
+		res, err := p.client.Get(ctx, p.Name(), p.baseURL+"/cdx/search/cdx?"+query.Encode())
+		if err != nil {
+			return err
+		}
+
+		raw, err := ioutil.ReadAll(res.Body)
+
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %s", res.Status)
+		}
+		// No capture at all gives an empty body instead of an empty array
+		if len(bytes.TrimSpace(raw)) == 0 {
+			return nil
+		}
+
+		var wrapper [][]string
+		if err := json.Unmarshal(raw, &wrapper); err != nil {
+			return err
+		}
+
+		// The rows end with an empty row and the resume key when there are more captures
+		resumeKey := ""
+		if n := len(wrapper); n >= 2 && len(wrapper[n-2]) == 0 && len(wrapper[n-1]) == 1 {
+			resumeKey = wrapper[n-1][0]
+			wrapper = wrapper[:n-2]
+		}
+
+		for i, row := range wrapper {
+			// The first row is always the field names, so we should skip it
+			if i == 0 || len(row) < 2 {
+				continue
+			}
+			results <- SourceURL{Date: row[0], URL: row[1]}
+		}
+
+		if resumeKey == "" {
+			return nil
+		}
+		query.Set("resumeKey", resumeKey)
+	}
+}
+
+// cdxFilter builds a CDX filter matching any of the values of a field
+func cdxFilter(field string, values []string) string {
+	var quoted []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			quoted = append(quoted, regexp.QuoteMeta(v))
+		}
+	}
+	if len(quoted) == 0 {
+		return ""
+	}
+	return field + ":(" + strings.Join(quoted, "|") + ")"
+}
+
+// DefaultCommonCrawlIndexes is the number of latest CommonCrawl indexes queried by default
+const DefaultCommonCrawlIndexes = 3
+
+type commonCrawlProvider struct {
+	client  *SourceClient
+	baseURL string
+	indexes int
+	from    string
+	to      string
+}
+
+func (p *commonCrawlProvider) Name() string {
+	return "commoncrawl"
+}
+
+// commonCrawlIndex is an entry of collinfo.json
+type commonCrawlIndex struct {
+	ID     string `json:"id"`
+	CDXAPI string `json:"cdx-api"`
+}
+
+// Fetch queries the newest index first, so that the first capture sent of a URL is its latest one
+func (p *commonCrawlProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	indexes, err := p.latestIndexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	subsWildcard := "*."
+	if noSubs {
+		subsWildcard = ""
+	}
+	query := url.Values{}
+	query.Set("url", subsWildcard+domain+"/*")
+	query.Set("output", "json")
+	if p.from != "" {
+		query.Set("from", p.from)
+	}
+	if p.to != "" {
+		query.Set("to", p.to)
+	}
+
+	failed := 0
+	for _, index := range indexes {
+		count, err := p.fetchIndex(ctx, index, query, results)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			Logger.Errorf("Failed to fetch CommonCrawl index %s: %s", index.ID, err)
+			failed++
+			continue
+		}
+		Logger.Debugf("Found %d URLs in CommonCrawl index %s", count, index.ID)
+	}
+	if failed > 0 && failed == len(indexes) {
+		return fmt.Errorf("all %d CommonCrawl indexes failed", failed)
+	}
+	return nil
+}
+
+// latestIndexes returns the newest indexes listed in collinfo.json
+func (p *commonCrawlProvider) latestIndexes(ctx context.Context) ([]commonCrawlIndex, error) {
+	res, err := p.client.Get(ctx, p.Name(), p.baseURL+"/collinfo.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("collinfo.json: unexpected status %s", res.Status)
+	}
+
+	var indexes []commonCrawlIndex
+	if err := json.NewDecoder(res.Body).Decode(&indexes); err != nil {
+		return nil, err
+	}
+	// collinfo.json lists the newest crawls first
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return indexes[i].ID > indexes[j].ID
+	})
+	if len(indexes) > p.indexes {
+		indexes = indexes[:p.indexes]
+	}
+	for i := range indexes {
+		if indexes[i].CDXAPI == "" {
+			indexes[i].CDXAPI = p.baseURL + "/" + indexes[i].ID + "-index"
+		}
+	}
+	return indexes, nil
+}
+
+// fetchIndex reads every page of the CDX API of an index and returns the number of captures sent
+func (p *commonCrawlProvider) fetchIndex(ctx context.Context, index commonCrawlIndex, query url.Values, results chan<- SourceURL) (int, error) {
+	pagesQuery := url.Values{}
+	for k, v := range query {
+		pagesQuery[k] = v
+	}
+	pagesQuery.Set("showNumPages", "true")
+
+	res, err := p.client.Get(ctx, p.Name(), index.CDXAPI+"?"+pagesQuery.Encode())
+	if err != nil {
+		return 0, err
+	}
+	// The CDX server answers 404 when the domain has no capture in this index
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return 0, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return 0, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	numPages := struct {
+		Pages int `json:"pages"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&numPages)
+	res.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for page := 0; page < numPages.Pages; page++ {
+		pageQuery := url.Values{}
+		for k, v := range query {
+			pageQuery[k] = v
+		}
+		pageQuery.Set("page", strconv.Itoa(page))
+
+		res, err := p.client.Get(ctx, p.Name(), index.CDXAPI+"?"+pageQuery.Encode())
+		if err != nil {
+			return count, err
+		}
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return count, fmt.Errorf("page %d: unexpected status %s", page, res.Status)
+		}
+
+		sc := bufio.NewScanner(res.Body)
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			wrapper := struct {
+				URL       string `json:"url"`
+				Timestamp string `json:"timestamp"`
+			}{}
+			if err := json.Unmarshal(sc.Bytes(), &wrapper); err != nil || wrapper.URL == "" {
+				continue
+			}
+			results <- SourceURL{Date: wrapper.Timestamp, URL: wrapper.URL}
+			count++
+		}
+		err = sc.Err()
+		res.Body.Close()
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+type virusTotalProvider struct {
+	client  *SourceClient
+	baseURL string
+	apiKey  string
+}
+
+func (p *virusTotalProvider) Name() string {
+	return "virustotal"
+}
+
+func (p *virusTotalProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	if p.apiKey == "" {
+		Logger.Warnf("You are not set VirusTotal API Key yet.")
+		return nil
+	}
+
+	fetchURL := fmt.Sprintf(
+		"%s/vtapi/v2/domain/report?apikey=%s&domain=%s",
+		p.baseURL,
+		p.apiKey,
+		domain,
+	)
+
+	wrapper := struct {
+		URLs []struct {
+			URL string `json:"url"`
+		} `json:"detected_urls"`
+	}{}
+	if err := p.client.GetJSON(ctx, p.Name(), fetchURL, &wrapper); err != nil {
+		return err
+	}
+
+	for _, u := range wrapper.URLs {
+		results <- SourceURL{URL: u.URL}
+	}
+
+	return nil
+}
+
+type otxProvider struct {
+	client  *SourceClient
+	baseURL string
+}
+
+func (p *otxProvider) Name() string {
+	return "otx"
+}
+
+func (p *otxProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	page := 0
+	for {
+		wrapper := struct {
+			HasNext    bool `json:"has_next"`
+			ActualSize int  `json:"actual_size"`
+			URLList    []struct {
+				Domain   string `json:"domain"`
+				URL      string `json:"url"`
+				Hostname string `json:"hostname"`
+				Httpcode int    `json:"httpcode"`
+				PageNum  int    `json:"page_num"`
+				FullSize int    `json:"full_size"`
+				Paged    bool   `json:"paged"`
+			} `json:"url_list"`
+		}{}
+		err := p.client.GetJSON(ctx, p.Name(), fmt.Sprintf("%s/api/v1/indicators/hostname/%s/url_list?limit=50&page=%d", p.baseURL, domain, page), &wrapper)
+		if err != nil {
+			// The URLs of the previous pages are already sent
+			return fmt.Errorf("page %d: %s", page, err)
+		}
+		for _, url := range wrapper.URLList {
+			results <- SourceURL{URL: url.URL}
+		}
+		if !wrapper.HasNext {
+			break
+		}
+		page++
+	}
+	return nil
+}
+
+type urlScanProvider struct {
+	client  *SourceClient
+	baseURL string
+	apiKey  string
+}
+
+func (p *urlScanProvider) Name() string {
+	return "urlscan"
+}
+
+func (p *urlScanProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	query := "domain:" + domain
+	if noSubs {
+		query = "page.domain:" + domain
+	}
+
+	searchAfter := ""
+	for {
+		params := url.Values{}
+		params.Set("q", query)
+		params.Set("size", "100")
+		if searchAfter != "" {
+			params.Set("search_after", searchAfter)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/v1/search/?"+params.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		if p.apiKey != "" {
+			req.Header.Set("API-Key", p.apiKey)
+		}
+		resp, err := p.client.Do(p.Name(), req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+
+		wrapper := struct {
+			Results []struct {
+				Page struct {
+					URL string `json:"url"`
+				} `json:"page"`
+				Task struct {
+					Time string `json:"time"`
+				} `json:"task"`
+				Sort []interface{} `json:"sort"`
+			} `json:"results"`
+			HasMore bool `json:"has_more"`
+		}{}
+		// Keep the sort values as written, they are sent back as is in search_after
+		dec := json.NewDecoder(resp.Body)
+		dec.UseNumber()
+		err = dec.Decode(&wrapper)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, r := range wrapper.Results {
+			results <- SourceURL{Date: r.Task.Time, URL: r.Page.URL}
+		}
+		if !wrapper.HasMore || len(wrapper.Results) == 0 {
+			break
+		}
+
+		var sortValues []string
+		for _, v := range wrapper.Results[len(wrapper.Results)-1].Sort {
+			sortValues = append(sortValues, fmt.Sprint(v))
+		}
+		searchAfter = strings.Join(sortValues, ",")
+	}
+	return nil
+}
+
+type hybridAnalysisProvider struct {
+	client  *SourceClient
+	baseURL string
+	apiKey  string
+}
+
+func (p *hybridAnalysisProvider) Name() string {
+	return "hybridanalysis"
+}
+
+func (p *hybridAnalysisProvider) Fetch(ctx context.Context, domain string, noSubs bool, results chan<- SourceURL) error {
+	if p.apiKey == "" {
+		Logger.Warnf("You are not set Hybrid Analysis API Key yet.")
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/v2/search/terms", strings.NewReader(url.Values{"domain": {domain}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Falcon Sandbox")
+	req.Header.Set("api-key", p.apiKey)
+	resp, err := p.client.Do(p.Name(), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	wrapper := struct {
+		Result []struct {
+			SubmitName   string `json:"submit_name"`
+			AnalysisTime string `json:"analysis_start_time"`
+		} `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&wrapper); err != nil {
+		return err
+	}
+
+	// URL analyses are submitted with the URL as name
+	for _, r := range wrapper.Result {
+		if strings.HasPrefix(r.SubmitName, "http") && strings.Contains(r.SubmitName, domain) {
+			results <- SourceURL{Date: r.AnalysisTime, URL: r.SubmitName}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/gocolly/colly/v2"
+)
+
+// Renderer executes a page like a browser and reports what the rendered page references.
+type Renderer interface {
+	Render(pageURL string) (*RenderResult, error)
+	Close() error
+}
+
+// RenderResult holds what was found while rendering a page
+type RenderResult struct {
+	// HTML is the rendered DOM
+	HTML string
+	// Links are the href, src and form action URLs of the rendered DOM
+	Links []string
+	// Requests are the XHR and fetch requests sent by the page
+	Requests []RenderRequest
+	// Routes are the client-side route changes (history API and hash changes)
+	Routes []string
+}
+
+type RenderRequest struct {
+	Method string
+	URL    string
+}
+
+// RenderOptions configures the Chromium renderer
+type RenderOptions struct {
+	// ExecPath of Chromium, found in the usual locations when empty
+	ExecPath string
+	// Proxy may hold credentials, they are given to Chromium over the DevTools protocol
+	// when the proxy asks for them, never on its command line
+	Proxy   string
+	Headers map[string]string
+	// Timeout of a page load
+	Timeout time.Duration
+	// Wait is the time given to the page scripts to run after the page is loaded
+	Wait time.Duration
+	// Allow decides whether the browser may send a request, all of them are sent when nil.
+	// static is true for the scripts, stylesheets, images, fonts and media needed to render the page.
+	Allow func(req RenderRequest, static bool) bool
+}
+
+// Collect every URL of the DOM, properties are used to get absolute URLs
+const renderLinksJS = `(() => {
+	const urls = [];
+	document.querySelectorAll('[href],[src],form[action]').forEach(e => {
+		const u = e.href || e.src || e.action;
+		if (typeof u === 'string') urls.push(u);
+		else if (u && u.baseVal) urls.push(new URL(u.baseVal, document.baseURI).href);
+	});
+	return urls;
+})()`
+
+// ChromeRenderer renders pages with a local headless Chromium driven over the DevTools protocol.
+type ChromeRenderer struct {
+	opts          RenderOptions
+	proxyAuth     *fetch.AuthChallengeResponse
+	allocCancel   context.CancelFunc
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+}
+
+func NewChromeRenderer(opts RenderOptions) (*ChromeRenderer, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Wait == 0 {
+		opts.Wait = 2 * time.Second
+	}
+
+	allocOpts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.IgnoreCertErrors,
+		chromedp.NoSandbox,
+	)
+	if opts.ExecPath != "" {
+		allocOpts = append(allocOpts, chromedp.ExecPath(opts.ExecPath))
+	}
+	var proxyAuth *fetch.AuthChallengeResponse
+	if opts.Proxy != "" {
+		server, user := splitProxyAuth(opts.Proxy)
+		allocOpts = append(allocOpts, chromedp.ProxyServer(server))
+		if user != nil {
+			password, _ := user.Password()
+			proxyAuth = &fetch.AuthChallengeResponse{
+				Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+				Username: user.Username(),
+				Password: password,
+			}
+		}
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), allocOpts...)
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+
+	// Start the browser now to report a missing Chromium early
+	if err := chromedp.Run(browserCtx); err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, fmt.Errorf("failed to start Chromium: %s", err)
+	}
+	return &ChromeRenderer{
+		opts:          opts,
+		proxyAuth:     proxyAuth,
+		allocCancel:   allocCancel,
+		browserCtx:    browserCtx,
+		browserCancel: browserCancel,
+	}, nil
+}
+
+func (r *ChromeRenderer) Render(pageURL string) (*RenderResult, error) {
+	tabCtx, tabCancel := chromedp.NewContext(r.browserCtx)
+	defer tabCancel()
+	ctx, cancel := context.WithTimeout(tabCtx, r.opts.Timeout+r.opts.Wait)
+	defer cancel()
+
+	var mu sync.Mutex
+	result := &RenderResult{}
+	navigated := false
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			if e.Type == network.ResourceTypeXHR || e.Type == network.ResourceTypeFetch {
+				result.Requests = append(result.Requests, RenderRequest{Method: e.Request.Method, URL: e.Request.URL})
+			}
+		case *page.EventNavigatedWithinDocument:
+			result.Routes = append(result.Routes, e.URL)
+		case *fetch.EventRequestPaused:
+			// The first document is the page itself, it is always sent.
+			// The listener must not block, the answer is sent from another goroutine.
+			page := !navigated && e.ResourceType == network.ResourceTypeDocument
+			navigated = navigated || page
+			go r.continueRequest(ctx, e, page)
+		case *fetch.EventAuthRequired:
+			go r.continueWithAuth(ctx, e)
+		}
+	})
+
+	headers := network.Headers{}
+	for k, v := range r.opts.Headers {
+		headers[k] = v
+	}
+
+	var links []string
+	var html string
+	actions := []chromedp.Action{network.Enable(), network.SetExtraHTTPHeaders(headers)}
+	if r.opts.Allow != nil || r.proxyAuth != nil {
+		actions = append(actions, fetch.Enable().WithHandleAuthRequests(r.proxyAuth != nil))
+	}
+	err := chromedp.Run(ctx,
+		chromedp.Tasks(actions),
+		chromedp.Navigate(pageURL),
+		chromedp.Sleep(r.opts.Wait),
+		chromedp.Evaluate(renderLinksJS, &links),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result.HTML = html
+	result.Links = links
+	return result, nil
+}
+
+// staticResources are the resource types fetched to render a page
+var staticResources = map[network.ResourceType]bool{
+	network.ResourceTypeScript:     true,
+	network.ResourceTypeStylesheet: true,
+	network.ResourceTypeImage:      true,
+	network.ResourceTypeFont:       true,
+	network.ResourceTypeMedia:      true,
+}
+
+// continueRequest sends or blocks a request of the page with the Allow option
+func (r *ChromeRenderer) continueRequest(ctx context.Context, e *fetch.EventRequestPaused, page bool) {
+	ctx = cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+	req := RenderRequest{Method: e.Request.Method, URL: e.Request.URL}
+	var err error
+	if page || r.opts.Allow == nil || r.opts.Allow(req, staticResources[e.ResourceType]) {
+		err = fetch.ContinueRequest(e.RequestID).Do(ctx)
+	} else {
+		Logger.Debugf("Render blocked %s %s", req.Method, req.URL)
+		err = fetch.FailRequest(e.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+	}
+	if err != nil && ctx.Err() == nil {
+		Logger.Debugf("Failed to continue the render request %s: %s", req.URL, err)
+	}
+}
+
+// continueWithAuth answers the proxy authentication challenges with the credentials of the proxy
+func (r *ChromeRenderer) continueWithAuth(ctx context.Context, e *fetch.EventAuthRequired) {
+	ctx = cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+	response := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseDefault}
+	if r.proxyAuth != nil && e.AuthChallenge != nil && e.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
+		response = r.proxyAuth
+	}
+	if err := fetch.ContinueWithAuth(e.RequestID, response).Do(ctx); err != nil && ctx.Err() == nil {
+		Logger.Debugf("Failed to answer the proxy authentication of %s: %s", e.Request.URL, err)
+	}
+}
+
+// splitProxyAuth splits the credentials from a proxy URL
+func splitProxyAuth(proxy string) (string, *url.Userinfo) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy, nil
+	}
+	user := u.User
+	u.User = nil
+	return u.String(), user
+}
+
+func (r *ChromeRenderer) Close() error {
+	r.browserCancel()
+	r.allocCancel()
+	return nil
+}
+
+// setupRenderer renders the HTML pages of the main collector and feeds
+// the discovered URLs back into it. The renders run on their own goroutines,
+// the pages wait for a tab without holding a worker of the collector.
+func (crawler *Crawler) setupRenderer() {
+	// Limit the number of opened tabs
+	tabs := make(chan struct{}, crawler.config.Concurrent)
+
+	crawler.C.OnResponse(func(response *colly.Response) {
+		if !crawler.scope.InScope(response.Request.URL) {
+			return
+		}
+		contentType := response.Headers.Get("Content-Type")
+		if contentType != "" && !strings.Contains(contentType, "html") {
+			return
+		}
+
+		crawler.renders.Add(1)
+		go func(request *colly.Request) {
+			defer crawler.renders.Done()
+			tabs <- struct{}{}
+			defer func() { <-tabs }()
+			crawler.render(request)
+		}(response.Request)
+	})
+}
+
+// render renders the page of a request and reports what it found
+func (crawler *Crawler) render(request *colly.Request) {
+	// A render loads the page again, it is spent on the budget like any request
+	if !crawler.budget.Request(request.URL.Host) {
+		return
+	}
+	pageURL := request.URL.String()
+	result, err := crawler.renderer.Render(pageURL)
+	if err != nil {
+		Logger.Errorf("Failed to render %s: %s", pageURL, err)
+		return
+	}
+
+	crawler.findSubdomains(result.HTML)
+	crawler.findCloudAssets(result.HTML, pageURL)
+	crawler.findSecrets(result.HTML, pageURL)
+
+	feed := func(outputType, method, u string) {
+		u = FixUrl(request.URL, u)
+		if u == "" || crawler.urlSet.Duplicate(u) {
+			return
+		}
+		crawler.emit(SpiderOutput{
+			Source:     "render",
+			OutputType: outputType,
+			Method:     method,
+			Output:     u,
+		})
+		if method == "" || method == "GET" {
+			crawler.visits <- queuedVisit{url: u, from: request}
+		}
+	}
+	for _, u := range result.Links {
+		feed("href", "", u)
+	}
+	for _, req := range result.Requests {
+		feed("xhr", req.Method, req.URL)
+	}
+	for _, u := range result.Routes {
+		feed("route", "", u)
+	}
+}
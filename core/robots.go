@@ -1,65 +1,257 @@
 package core
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
-
-	jsoniter "github.com/json-iterator/go"
+	"time"
 
 	"github.com/gocolly/colly/v2"
 )
 
+// RobotsRule is an Allow or Disallow line of robots.txt
+type RobotsRule struct {
+	// UserAgents are the agents of the group of the rule
+	UserAgents []string `json:"user_agents"`
+	// Type is allow or disallow
+	Type string `json:"type"`
+	// Path is the path pattern, it may use the * and $ wildcards
+	Path string `json:"path"`
+
+	re *regexp.Regexp
+}
+
+// Wildcard tells whether the path is a pattern rather than a plain path
+func (r RobotsRule) Wildcard() bool {
+	return strings.ContainsAny(r.Path, "*$")
+}
+
+// RobotsGroup is the set of rules for some user agents
+type RobotsGroup struct {
+	UserAgents []string
+	Rules      []RobotsRule
+	CrawlDelay time.Duration
+}
+
+// Robots is a parsed robots.txt
+type Robots struct {
+	Groups   []*RobotsGroup
+	Sitemaps []string
+}
+
+// ParseRobotsTxt parses a robots.txt.
+// Consecutive User-agent lines share the rules and Crawl-delay that follow them.
+func ParseRobotsTxt(body []byte) *Robots {
+	robots := &Robots{}
+	var group *RobotsGroup
+	inRules := false
+	for _, line := range strings.Split(string(body), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if group == nil || inRules {
+				group = &RobotsGroup{}
+				robots.Groups = append(robots.Groups, group)
+				inRules = false
+			}
+			group.UserAgents = append(group.UserAgents, value)
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything, there is nothing to record
+			if group == nil || value == "" {
+				continue
+			}
+			group.Rules = append(group.Rules, RobotsRule{
+				UserAgents: group.UserAgents,
+				Type:       key,
+				Path:       value,
+				re:         robotsPattern(value),
+			})
+		case "crawl-delay":
+			inRules = true
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+				group.CrawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+		}
+	}
+	return robots
+}
+
+// robotsPattern compiles a path pattern where * matches anything and a final $ ends the path
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	expr := "^" + strings.Replace(regexp.QuoteMeta(path), `\*`, ".*", -1)
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// Group returns the group of the most specific user agent matching userAgent,
+// the * group when there is none, or nil.
+func (r *Robots) Group(userAgent string) *RobotsGroup {
+	userAgent = strings.ToLower(userAgent)
+	var best, wildcard *RobotsGroup
+	bestLen := 0
+	for _, g := range r.Groups {
+		for _, agent := range g.UserAgents {
+			agent = strings.ToLower(agent)
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if agent != "" && strings.Contains(userAgent, agent) && len(agent) > bestLen {
+				best, bestLen = g, len(agent)
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return wildcard
+}
+
+// Allowed tells whether a path (with its query) may be crawled.
+// The longest matching rule wins, Allow wins a tie.
+func (g *RobotsGroup) Allowed(path string) bool {
+	if g == nil {
+		return true
+	}
+	allowed := true
+	matchLen := -1
+	for _, rule := range g.Rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.Path) > matchLen || (len(rule.Path) == matchLen && rule.Type == "allow") {
+			allowed = rule.Type == "allow"
+			matchLen = len(rule.Path)
+		}
+	}
+	return allowed
+}
+
 func ParseRobots(site *url.URL, crawler *Crawler, c *colly.Collector, wg *sync.WaitGroup) {
 	defer wg.Done()
-	robotsURL := site.String() + "/robots.txt"
+	robotsURL := site.Scheme + "://" + site.Host + "/robots.txt"
 
-	resp, err := http.Get(robotsURL)
-	if err != nil {
+	body := crawler.robotsTxt()
+	if body == nil {
 		return
 	}
-	if resp.StatusCode == 200 {
-		Logger.Infof("Found robots.txt: %s", robotsURL)
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return
-		}
-		lines := strings.Split(string(body), "\n")
-
-		var re = regexp.MustCompile(".*llow: ")
-		for _, line := range lines {
-			if strings.Contains(line, "llow: ") {
-				url := re.ReplaceAllString(line, "")
-				url = FixUrl(site, url)
-				if url == "" {
+	Logger.Infof("Found robots.txt: %s", robotsURL)
+
+	base := site.Scheme + "://" + site.Host
+	reported := make(map[string]bool)
+	for _, group := range ParseRobotsTxt(body).Groups {
+		for _, rule := range group.Rules {
+			rule := rule
+			if rule.Type == "disallow" {
+				// Disallowed paths are what the site does not want to show
+				if reported[rule.Path] {
 					continue
 				}
-				outputFormat := fmt.Sprintf("[robots] - %s", url)
-
-				if crawler.JsonOutput {
-					sout := SpiderOutput{
-						Input:      crawler.Input,
-						Source:     "robots",
-						OutputType: "url",
-						Output:     url,
-					}
-					if data, err := jsoniter.MarshalToString(sout); err == nil {
-						outputFormat = data
-					}
-				} else if crawler.Quiet {
-					outputFormat = url
-				}
-				fmt.Println(outputFormat)
-				if crawler.Output != nil {
-					crawler.Output.WriteToFile(outputFormat)
-				}
-				_ = c.Visit(url)
+				reported[rule.Path] = true
+				crawler.emit(SpiderOutput{
+					Source:     "robots",
+					OutputType: "interesting-path",
+					Output:     base + rule.Path,
+					Robots:     &rule,
+				})
+			}
+			// Patterns are not URLs
+			if rule.Wildcard() {
+				continue
+			}
+			u := FixUrl(site, rule.Path)
+			if u == "" {
+				continue
+			}
+			if rule.Type == "allow" && !crawler.urlSet.Duplicate(u) {
+				crawler.emit(SpiderOutput{
+					Source:     "robots",
+					OutputType: "url",
+					Output:     u,
+					Robots:     &rule,
+				})
+			}
+			if crawler.allowedURL(c, u) {
+				_ = c.Visit(u)
 			}
 		}
 	}
+}
 
+// robotsTxt returns the robots.txt of the site, or nil when there is none.
+// It is downloaded once and shared by the robots and sitemap parsers.
+func (crawler *Crawler) robotsTxt() []byte {
+	crawler.robotsOnce.Do(func() {
+		resp, err := crawler.get(crawler.site.Scheme + "://" + crawler.site.Host + "/robots.txt")
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return
+		}
+		crawler.robotsBody = body
+	})
+	return crawler.robotsBody
+}
+
+// robotsAgent is the user agent matched against the robots.txt groups in polite mode
+func (crawler *Crawler) robotsAgent() string {
+	if ua := strings.ToLower(crawler.config.UserAgent); ua != "" && ua != "web" && ua != "mobi" {
+		return crawler.config.UserAgent
+	}
+	return "*"
+}
+
+// setupPolite makes the crawler follow the robots.txt rules of the site
+// and returns its Crawl-delay
+func (crawler *Crawler) setupPolite() time.Duration {
+	crawler.robotsGroup = ParseRobotsTxt(crawler.robotsTxt()).Group(crawler.robotsAgent())
+	if crawler.robotsGroup == nil {
+		return 0
+	}
+	return crawler.robotsGroup.CrawlDelay
+}
+
+// robotsAllowed tells whether robots.txt allows to request u in polite mode
+func (crawler *Crawler) robotsAllowed(u *url.URL) bool {
+	if crawler.robotsGroup == nil || u.Host != crawler.site.Host {
+		return true
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return crawler.robotsGroup.Allowed(path)
 }
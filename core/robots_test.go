@@ -0,0 +1,169 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const robotsFixture = `# comment
+User-agent: Googlebot
+User-agent: arachnid
+Disallow: /private/
+Allow: /private/public.html
+Crawl-delay: 1.5
+
+User-agent: *
+Disallow: /admin
+Disallow: /a/downloads/-/*
+Disallow: /*.php$
+Disallow:
+Allow: /admin/login
+
+Sitemap: https://example.com/sitemap-1.xml
+`
+
+func TestParseRobotsTxt(t *testing.T) {
+	robots := ParseRobotsTxt([]byte(robotsFixture))
+	if len(robots.Groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(robots.Groups))
+	}
+	first := robots.Groups[0]
+	if !reflect.DeepEqual(first.UserAgents, []string{"Googlebot", "arachnid"}) || first.CrawlDelay != 1500*time.Millisecond {
+		t.Errorf("unexpected first group %+v", first)
+	}
+	if len(robots.Groups[1].Rules) != 4 {
+		t.Errorf("got %d rules in the * group, want 4", len(robots.Groups[1].Rules))
+	}
+	if !reflect.DeepEqual(robots.Sitemaps, []string{"https://example.com/sitemap-1.xml"}) {
+		t.Errorf("unexpected sitemaps %v", robots.Sitemaps)
+	}
+
+	if g := robots.Group("Mozilla/5.0 (compatible; Arachnid/1.0)"); g != first {
+		t.Error("arachnid group not selected")
+	}
+	group := robots.Group("curl/7.0")
+	if group != robots.Groups[1] {
+		t.Fatal("* group not selected")
+	}
+	tests := map[string]bool{
+		"/":                       true,
+		"/admin":                  false,
+		"/admin/users":            false,
+		"/admin/login":            true,
+		"/a/downloads/-/file.zip": false,
+		"/a/downloads/file.zip":   true,
+		"/index.php":              false,
+		"/index.php?x=1":          true,
+		"/private/":               true,
+	}
+	for path, want := range tests {
+		if got := group.Allowed(path); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", path, got, want)
+		}
+	}
+	if !first.Allowed("/private/public.html") || first.Allowed("/private/secret.html") {
+		t.Error("longest match does not win")
+	}
+}
+
+func newRobotsServer(visited map[string]bool, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path] = true
+		mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, robotsFixture)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/admin/users">users</a><a href="/about">about</a>`)
+	}))
+}
+
+func TestParseRobots(t *testing.T) {
+	var mu sync.Mutex
+	visited := make(map[string]bool)
+	ts := newRobotsServer(visited, &mu)
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]string)
+	for out := range ch {
+		if out.Source == "robots" {
+			found[out.Output] = out.OutputType
+		}
+	}
+	want := map[string]string{
+		ts.URL + "/private/":            "interesting-path",
+		ts.URL + "/private/public.html": "url",
+		ts.URL + "/admin":               "interesting-path",
+		ts.URL + "/a/downloads/-/*":     "interesting-path",
+		ts.URL + "/*.php$":              "interesting-path",
+		ts.URL + "/admin/login":         "url",
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got %v, want %v", found, want)
+	}
+	// Plain paths are crawled, patterns are not
+	if !visited["/admin"] || visited["/a/downloads/-/*"] || visited["/a/downloads/-/"] {
+		t.Errorf("unexpected visits %v", visited)
+	}
+}
+
+func TestPoliteMode(t *testing.T) {
+	var mu sync.Mutex
+	visited := make(map[string]bool)
+	ts := newRobotsServer(visited, &mu)
+	defer ts.Close()
+	// robots.txt is at the root of a site given with a trailing slash
+	site, _ := url.Parse(ts.URL + "/")
+
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 2
+	cfg.Polite = true
+	cfg.Sitemap = true
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(visited) > 0 {
+		t.Errorf("robots.txt downloaded before the crawl: %v", visited)
+	}
+	mu.Unlock()
+	crawler.Run()
+
+	for _, path := range []string{"/robots.txt", "/sitemap.xml"} {
+		if !visited[path] || visited["/"+path] {
+			t.Errorf("%s not requested at the root: %v", path, visited)
+		}
+	}
+
+	for _, path := range []string{"/admin", "/admin/users"} {
+		if visited[path] {
+			t.Errorf("%s crawled in polite mode", path)
+		}
+	}
+	for _, path := range []string{"/about", "/admin/login"} {
+		if !visited[path] {
+			t.Errorf("%s not crawled in polite mode", path)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScopeRule includes or excludes the URLs matching all of its conditions
+type ScopeRule struct {
+	Include    bool
+	Conditions []ScopeCondition
+	// Origin tells where the rule comes from, like "site" or "scope.txt:3"
+	Origin string
+}
+
+// ScopeCondition is a single check of a URL.
+// Kind is one of host, cidr, path, regex, port or scheme.
+type ScopeCondition struct {
+	Kind  string
+	Value string
+
+	match func(u *url.URL) bool
+}
+
+// Match tells whether u matches every condition of the rule
+func (r ScopeRule) Match(u *url.URL) bool {
+	for _, cond := range r.Conditions {
+		if !cond.match(u) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r ScopeRule) String() string {
+	s := "exclude"
+	if r.Include {
+		s = "include"
+	}
+	for _, cond := range r.Conditions {
+		s += " " + cond.Kind + " " + cond.Value
+	}
+	return s
+}
+
+// ParseScopeRule parses a rule written as an action followed by kind and value pairs:
+//
+//	include host *.example.com
+//	exclude path /logout
+//	include cidr 10.0.0.0/8 port 8000-8100
+//
+// Values can't hold spaces, use \s in regexes.
+func ParseScopeRule(line string) (ScopeRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields)%2 == 0 {
+		return ScopeRule{}, fmt.Errorf("invalid scope rule %q, expected: include|exclude <kind> <value> ...", line)
+	}
+
+	var rule ScopeRule
+	switch strings.ToLower(fields[0]) {
+	case "include":
+		rule.Include = true
+	case "exclude":
+	default:
+		return ScopeRule{}, fmt.Errorf("invalid scope rule %q: unknown action %s", line, fields[0])
+	}
+	for i := 1; i < len(fields); i += 2 {
+		cond, err := NewScopeCondition(fields[i], fields[i+1])
+		if err != nil {
+			return ScopeRule{}, fmt.Errorf("invalid scope rule %q: %s", line, err)
+		}
+		rule.Conditions = append(rule.Conditions, cond)
+	}
+	return rule, nil
+}
+
+// NewScopeCondition builds a condition:
+//   - host: glob on the hostname, *.example.com does not match example.com itself
+//   - cidr: IP range of the hostname, the hostname is not resolved
+//   - path: prefix of the path
+//   - regex: regex on the whole URL
+//   - port: port or port range like 8000-8100, 80 and 443 by default
+//   - scheme: http or https
+func NewScopeCondition(kind, value string) (ScopeCondition, error) {
+	cond := ScopeCondition{Kind: strings.ToLower(kind), Value: value}
+	switch cond.Kind {
+	case "host":
+		pattern := strings.ToLower(value)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cond, fmt.Errorf("invalid host glob %s: %s", value, err)
+		}
+		cond.match = func(u *url.URL) bool {
+			ok, _ := path.Match(pattern, strings.ToLower(u.Hostname()))
+			return ok
+		}
+	case "cidr":
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return cond, fmt.Errorf("invalid CIDR %s", cond.Value)
+		}
+		cond.match = func(u *url.URL) bool {
+			ip := net.ParseIP(u.Hostname())
+			return ip != nil && ipNet.Contains(ip)
+		}
+	case "path":
+		cond.match = func(u *url.URL) bool {
+			p := u.Path
+			if p == "" {
+				p = "/"
+			}
+			return strings.HasPrefix(p, value)
+		}
+	case "regex":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return cond, fmt.Errorf("invalid regex %s: %s", value, err)
+		}
+		cond.match = func(u *url.URL) bool {
+			return re.MatchString(u.String())
+		}
+	case "port":
+		low, high, err := parsePortRange(value)
+		if err != nil {
+			return cond, err
+		}
+		cond.match = func(u *url.URL) bool {
+			port, err := strconv.Atoi(urlPort(u))
+			return err == nil && port >= low && port <= high
+		}
+	case "scheme":
+		cond.match = func(u *url.URL) bool {
+			return strings.EqualFold(u.Scheme, value)
+		}
+	default:
+		return cond, fmt.Errorf("unknown kind %s, expected host, cidr, path, regex, port or scheme", kind)
+	}
+	return cond, nil
+}
+
+func parsePortRange(value string) (int, int, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	low, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %s", value)
+	}
+	high := low
+	if len(bounds) == 2 {
+		if high, err = strconv.Atoi(bounds[1]); err != nil || high < low {
+			return 0, 0, fmt.Errorf("invalid port range %s", value)
+		}
+	}
+	return low, high, nil
+}
+
+// urlPort returns the port of u, or the default port of its scheme
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// LoadScopeFile reads scope rules from a file, one per line.
+// Empty lines and lines starting with # are ignored.
+func LoadScopeFile(filename string) ([]ScopeRule, error) {
+	f, err := os.Open(NormalizePath(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ScopeRule
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseScopeRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, n, err)
+		}
+		rule.Origin = fmt.Sprintf("%s:%d", filename, n)
+		rules = append(rules, rule)
+	}
+	return rules, sc.Err()
+}
+
+// Scope decides which URLs are crawled.
+// The last rule matching a URL decides, URLs matching no rule are out of scope.
+type Scope struct {
+	Rules []ScopeRule
+}
+
+// NewScope builds the scope of a site from the config:
+// the site host (and its subdomains with Subs) and the whitelists,
+// then the ScopeRules of the config and finally the blacklist.
+func NewScope(site *url.URL, cfg *CrawlerConfig) (*Scope, error) {
+	scope := &Scope{}
+	add := func(include bool, origin, kind, value string) error {
+		cond, err := NewScopeCondition(kind, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", origin, err)
+		}
+		scope.Rules = append(scope.Rules, ScopeRule{Include: include, Conditions: []ScopeCondition{cond}, Origin: origin})
+		return nil
+	}
+
+	if err := add(true, "site", "host", site.Hostname()); err != nil {
+		return nil, err
+	}
+	if cfg.Subs {
+		if err := add(true, "subs", "host", "*."+site.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Whitelist != "" {
+		if err := add(true, "whitelist", "regex", cfg.Whitelist); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.WhitelistDomain != "" {
+		if err := add(true, "whitelist-domain", "regex", "http(s)?://"+cfg.WhitelistDomain); err != nil {
+			return nil, err
+		}
+	}
+
+	scope.Rules = append(scope.Rules, cfg.ScopeRules...)
+
+	if cfg.Blacklist != "" {
+		if err := add(false, "blacklist", "regex", cfg.Blacklist); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// Explain returns whether u is in scope and the rule deciding it, nil when no rule matches
+func (s *Scope) Explain(u *url.URL) (bool, *ScopeRule) {
+	for i := len(s.Rules) - 1; i >= 0; i-- {
+		if s.Rules[i].Match(u) {
+			return s.Rules[i].Include, &s.Rules[i]
+		}
+	}
+	return false, nil
+}
+
+// InScope tells whether u should be crawled
+func (s *Scope) InScope(u *url.URL) bool {
+	in, _ := s.Explain(u)
+	return in
+}
+
+// Excluded tells whether an exclude rule decides u, URLs matching no rule are not excluded
+func (s *Scope) Excluded(u *url.URL) bool {
+	in, rule := s.Explain(u)
+	return rule != nil && !in
+}
+
+// InScopeURL is InScope for a raw URL, invalid URLs are out of scope
+func (s *Scope) InScopeURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && s.InScope(u)
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	scopeFile := filepath.Join(t.TempDir(), "scope.txt")
+	err := ioutil.WriteFile(scopeFile, []byte(`# internal apps
+include cidr 10.0.0.0/8 port 8000-8100
+
+exclude path /logout
+exclude scheme http host *.example.com
+include path /logout/help
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadScopeFile(scopeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site, _ := url.Parse("https://example.com")
+	cfg := NewCrawlerConfig()
+	cfg.Subs = true
+	cfg.ScopeRules = rules
+	cfg.Blacklist = `delete`
+	scope, err := NewScope(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url    string
+		in     bool
+		origin string
+	}{
+		{"https://example.com/", true, "site"},
+		{"https://EXAMPLE.com:8443/a", true, "site"},
+		{"https://www.example.com/a", true, "subs"},
+		{"http://www.example.com/a", false, scopeFile + ":5"},
+		{"https://notexample.com/", false, ""},
+		{"https://example.com.evil.com/", false, ""},
+		{"https://other.com/?u=example.com", false, ""},
+		{"http://10.1.2.3:8080/", true, scopeFile + ":2"},
+		{"http://10.1.2.3/", false, ""},
+		{"https://example.com/logout", false, scopeFile + ":4"},
+		{"https://example.com/logout/help", true, scopeFile + ":6"},
+		{"https://example.com/logout/help?delete=1", false, "blacklist"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		in, rule := scope.Explain(u)
+		if in != test.in {
+			t.Errorf("%s: got in scope %v, want %v", test.url, in, test.in)
+		}
+		origin := ""
+		if rule != nil {
+			origin = rule.Origin
+		}
+		if origin != test.origin {
+			t.Errorf("%s: decided by %q, want %q", test.url, origin, test.origin)
+		}
+	}
+
+	for _, line := range []string{
+		"include host",
+		"allow host example.com",
+		"include domain example.com",
+		"include cidr 10.0.0.0/33",
+		"include port 90-80",
+		"include regex (",
+		"include host example.com path",
+	} {
+		if _, err := ParseScopeRule(line); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+func TestWhitelistAddsToSite(t *testing.T) {
+	site, _ := url.Parse("https://example.com")
+	cfg := NewCrawlerConfig()
+	cfg.WhitelistDomain = `api\.example\.com`
+	scope, err := NewScope(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scope.InScopeURL("https://example.com/") || !scope.InScopeURL("https://api.example.com/v1") || scope.InScopeURL("https://www.example.com/") {
+		t.Errorf("unexpected scope: %v", scope.Rules)
+	}
+}
+
+func TestScopeCrawl(t *testing.T) {
+	var mu sync.Mutex
+	visited := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path] = true
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/app.js":
+			fmt.Fprint(w, `fetch("/api/users")`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a><a href="/admin/">admin</a><script src="/app.js"></script><script src="/admin/app.js"></script>`)
+		}
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	rule, err := ParseScopeRule("exclude path /admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 2
+	cfg.Robots = false
+	cfg.ScopeRules = []ScopeRule{rule}
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+
+	for _, path := range []string{"/about", "/app.js"} {
+		if !visited[path] {
+			t.Errorf("%s not crawled", path)
+		}
+	}
+	for _, path := range []string{"/admin/", "/admin/app.js"} {
+		if visited[path] {
+			t.Errorf("%s crawled while out of scope", path)
+		}
+	}
+}
+
+func TestScopeOtherHosts(t *testing.T) {
+	var mu sync.Mutex
+	visited := make(map[string]bool)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.Host+r.URL.Path] = true
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/lib.js", "/blocked.js":
+			fmt.Fprint(w, `fetch("/api/users")`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a>`)
+		}
+	}
+	cdn := httptest.NewServer(http.HandlerFunc(handler))
+	defer cdn.Close()
+	var cdnURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			handler(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="%[1]s/page">cdn</a><script src="%[1]s/lib.js"></script><script src="%[1]s/blocked.js"></script>`, cdnURL)
+	}))
+	defer ts.Close()
+	// Both servers listen on 127.0.0.1, the CDN is requested by another name
+	site, _ := url.Parse(ts.URL)
+	cdnHost := "localhost:" + cdn.URL[strings.LastIndex(cdn.URL, ":")+1:]
+	cdnURL = "http://" + cdnHost
+
+	rule, err := ParseScopeRule("exclude path /blocked.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 2
+	cfg.Robots = false
+	cfg.ScopeRules = []ScopeRule{rule}
+	cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+
+	if !visited[cdnHost+"/lib.js"] {
+		t.Error("JavaScript of another host not fetched by the link finder")
+	}
+	for _, path := range []string{"/page", "/blocked.js", "/api/users"} {
+		if visited[cdnHost+path] {
+			t.Errorf("%s crawled while out of scope", path)
+		}
+	}
+	// Out of scope URLs are not even marked as visited
+	if v, _ := crawler.C.HasVisited(cdnURL + "/page"); v {
+		t.Error("out of scope URL marked as visited")
+	}
+}
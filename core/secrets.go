@@ -0,0 +1,229 @@
+package core
+
+import (
+	_ "embed"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultSecretContext is how many characters around a secret are kept as its context
+const DefaultSecretContext = 40
+
+//go:embed secrets.yaml
+var defaultSecretRules []byte
+
+// SecretRule detects a kind of secret
+type SecretRule struct {
+	ID          string `yaml:"id"`
+	Description string `yaml:"description"`
+	Regex       string `yaml:"regex"`
+	// Group is the regex group holding the secret, the whole match when 0
+	Group int `yaml:"group"`
+	// Entropy is the min Shannon entropy of the secret, in bits per character,
+	// which rejects the placeholders and the repeated characters
+	Entropy float64 `yaml:"entropy"`
+	// Disabled turns off the default rule of the same ID
+	Disabled bool `yaml:"disabled"`
+
+	re *regexp.Regexp
+}
+
+func (r *SecretRule) compile() error {
+	if r.ID == "" {
+		return fmt.Errorf("secret rule without id")
+	}
+	if r.Disabled {
+		return nil
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf("secret rule %s: invalid regex: %s", r.ID, err)
+	}
+	if r.Group < 0 || r.Group > re.NumSubexp() {
+		return fmt.Errorf("secret rule %s: no group %d in the regex", r.ID, r.Group)
+	}
+	if r.Entropy < 0 {
+		return fmt.Errorf("secret rule %s: negative entropy", r.ID)
+	}
+	r.re = re
+	return nil
+}
+
+// Secret is a secret found in a response
+type Secret struct {
+	Rule    string  `json:"rule"`
+	Value   string  `json:"value"`
+	Entropy float64 `json:"entropy"`
+	// Line is the line of the secret in the response, from 1
+	Line int `json:"line"`
+	// Context is the text around the secret, on a single line
+	Context string `json:"context"`
+}
+
+// ParseSecretRules parses a YAML list of secret rules, see secrets.yaml
+func ParseSecretRules(data []byte) ([]SecretRule, error) {
+	var rules []SecretRule
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// LoadSecretRules reads secret rules from a YAML file
+func LoadSecretRules(filename string) ([]SecretRule, error) {
+	data, err := ioutil.ReadFile(NormalizePath(filename))
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseSecretRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secret rules %s: %s", filename, err)
+	}
+	return rules, nil
+}
+
+// DefaultSecretRules returns the rules shipped with the crawler
+func DefaultSecretRules() []SecretRule {
+	rules, err := ParseSecretRules(defaultSecretRules)
+	if err != nil {
+		panic("invalid default secret rules: " + err.Error())
+	}
+	return rules
+}
+
+// SecretScanner finds the secrets of a text with its rules
+type SecretScanner struct {
+	Rules []SecretRule
+	// ContextSize is how many characters around a secret are kept as its context
+	ContextSize int
+}
+
+// NewSecretScanner returns a scanner with the default rules and extra ones.
+// An extra rule replaces the default rule of the same ID.
+func NewSecretScanner(extra []SecretRule) (*SecretScanner, error) {
+	rules := DefaultSecretRules()
+	for _, rule := range extra {
+		if rule.re == nil && !rule.Disabled {
+			if err := rule.compile(); err != nil {
+				return nil, err
+			}
+		}
+		replaced := false
+		for i := range rules {
+			if rules[i].ID == rule.ID {
+				rules[i], replaced = rule, true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+
+	var enabled []SecretRule
+	for _, rule := range rules {
+		if !rule.Disabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	return &SecretScanner{Rules: enabled, ContextSize: DefaultSecretContext}, nil
+}
+
+// Scan returns the secrets of source, each value once per rule
+func (s *SecretScanner) Scan(source string) []Secret {
+	var secrets []Secret
+	seen := make(map[string]bool)
+	for _, rule := range s.Rules {
+		for _, m := range rule.re.FindAllStringSubmatchIndex(source, -1) {
+			start, end := m[2*rule.Group], m[2*rule.Group+1]
+			if start < 0 {
+				continue
+			}
+			value := source[start:end]
+			entropy := ShannonEntropy(value)
+			if entropy < rule.Entropy || seen[rule.ID+"|"+value] {
+				continue
+			}
+			seen[rule.ID+"|"+value] = true
+			secrets = append(secrets, Secret{
+				Rule:    rule.ID,
+				Value:   value,
+				Entropy: math.Round(entropy*100) / 100,
+				Line:    strings.Count(source[:start], "\n") + 1,
+				Context: secretContext(source, start, end, s.ContextSize),
+			})
+		}
+	}
+	return secrets
+}
+
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// secretContext returns the text around source[start:end] on a single line
+func secretContext(source string, start, end, size int) string {
+	from, to := start-size, end+size
+	if from < 0 {
+		from = 0
+	}
+	if to > len(source) {
+		to = len(source)
+	}
+	// Don't cut a UTF-8 character
+	for from > 0 && from < start && !isRuneStart(source[from]) {
+		from--
+	}
+	for to < len(source) && !isRuneStart(source[to]) {
+		to++
+	}
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(source[from:to], " "))
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// ShannonEntropy returns the entropy of s in bits per character
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// findSecrets reports the secrets of a response or script, from is its URL
+func (crawler *Crawler) findSecrets(source string, from string) {
+	if crawler.secrets == nil {
+		return
+	}
+	for _, secret := range crawler.secrets.Scan(source) {
+		secret := secret
+		if !crawler.secretSet.Duplicate(secret.Rule + "|" + secret.Value) {
+			crawler.emit(SpiderOutput{
+				Source:     from,
+				OutputType: "secret",
+				Output:     secret.Value,
+				Secret:     &secret,
+			})
+		}
+	}
+}
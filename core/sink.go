@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ResultSink receives every finding produced by a Crawler.
+type ResultSink interface {
+	Write(out SpiderOutput)
+	Close() error
+}
+
+// Text returns the plain text line(s) used for the output in the non JSON formats.
+func (o SpiderOutput) Text(length bool) string {
+	switch o.OutputType {
+	case "url":
+		if o.Source != "body" {
+			return fmt.Sprintf("[%s] - %s", o.Source, o.Output)
+		}
+		if length {
+			return fmt.Sprintf("[url] - [code-%d] - [len_%d] - %s", o.StatusCode, o.ContentLength, o.Output)
+		}
+		return fmt.Sprintf("[url] - [code-%d] - %s", o.StatusCode, o.Output)
+	case "subdomain":
+		return fmt.Sprintf("[subdomains] - http://%s\n[subdomains] - https://%s", o.Output, o.Output)
+	case "aws", "cloud":
+		// The S3 buckets go to a file of their own, in the same format as the other providers
+		if o.Cloud != nil && o.Cloud.Region != "" {
+			return fmt.Sprintf("[cloud] - [%s] - [bucket: %s] - [region: %s] - %s", o.Cloud.Provider, o.Cloud.Bucket, o.Cloud.Region, o.Output)
+		}
+		if o.Cloud != nil {
+			return fmt.Sprintf("[cloud] - [%s] - [bucket: %s] - %s", o.Cloud.Provider, o.Cloud.Bucket, o.Output)
+		}
+	case "raw":
+		return fmt.Sprintf("[Raw] - \n%s\n", o.Output)
+	case "secret":
+		if o.Secret != nil {
+			return fmt.Sprintf("[secret] - [%s] - [from: %s] - %s - %s", o.Secret.Rule, o.Source, o.Output, o.Secret.Context)
+		}
+	case "technology":
+		if o.Technology != nil && len(o.Technology.Categories) > 0 {
+			return fmt.Sprintf("[technology] - [%s] - %s - %s", o.Technology.Host, o.Output, strings.Join(o.Technology.Categories, ", "))
+		}
+		if o.Technology != nil {
+			return fmt.Sprintf("[technology] - [%s] - %s", o.Technology.Host, o.Output)
+		}
+	case "linkfinder":
+		if strings.HasPrefix(o.Source, "http") && o.Method != "" {
+			return fmt.Sprintf("[linkfinder] - [from: %s] - [%s] - %s", o.Source, o.Method, o.Output)
+		}
+		if strings.HasPrefix(o.Source, "http") {
+			return fmt.Sprintf("[linkfinder] - [from: %s] - %s", o.Source, o.Output)
+		}
+	}
+	if o.Method != "" {
+		return fmt.Sprintf("[%s] - [%s] - %s", o.OutputType, o.Method, o.Output)
+	}
+	return fmt.Sprintf("[%s] - %s", o.OutputType, o.Output)
+}
+
+// TextSink writes findings as plain text lines.
+// In quiet mode only the URLs are written.
+type TextSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	quiet  bool
+	length bool
+}
+
+func NewTextSink(w io.Writer, quiet, length bool) *TextSink {
+	return &TextSink{w: w, quiet: quiet, length: length}
+}
+
+func (s *TextSink) Write(out SpiderOutput) {
+	line := out.Text(s.length)
+	if s.quiet {
+		if out.OutputType != "url" {
+			return
+		}
+		line = out.Output
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = fmt.Fprintln(s.w, line)
+}
+
+func (s *TextSink) Close() error {
+	return nil
+}
+
+// JSONSink writes findings as JSON lines.
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+func (s *JSONSink) Write(out SpiderOutput) {
+	data, err := jsoniter.MarshalToString(out)
+	if err != nil {
+		Logger.Errorf("Failed to marshal output: %s", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = fmt.Fprintln(s.w, data)
+}
+
+func (s *JSONSink) Close() error {
+	return nil
+}
+
+// FileSink writes findings to the per-type Output files, as text or JSON lines.
+type FileSink struct {
+	output *Output
+	json   bool
+	length bool
+}
+
+func NewFileSink(output *Output, json, length bool) *FileSink {
+	return &FileSink{output: output, json: json, length: length}
+}
+
+func (s *FileSink) Write(out SpiderOutput) {
+	if s.json {
+		data, err := jsoniter.MarshalToString(out)
+		if err != nil {
+			Logger.Errorf("Failed to marshal output: %s", err)
+			return
+		}
+		s.output.WriteToFile(out.OutputType, data)
+		return
+	}
+	s.output.WriteToFile(out.OutputType, out.Text(s.length))
+}
+
+func (s *FileSink) Close() error {
+	s.output.Close()
+	return nil
+}
+
+// ChannelSink sends findings to a Go channel so they can be consumed by embedding programs.
+// The channel is owned by the caller and is never closed by the sink.
+type ChannelSink struct {
+	ch chan<- SpiderOutput
+}
+
+func NewChannelSink(ch chan<- SpiderOutput) *ChannelSink {
+	return &ChannelSink{ch: ch}
+}
+
+func (s *ChannelSink) Write(out SpiderOutput) {
+	s.ch <- out
+}
+
+func (s *ChannelSink) Close() error {
+	return nil
+}
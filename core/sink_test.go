@@ -0,0 +1,51 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSpiderOutputText(t *testing.T) {
+	tests := []struct {
+		out  SpiderOutput
+		want string
+	}{
+		{SpiderOutput{Source: "body", OutputType: "url", StatusCode: 200, Output: "https://a.com/"}, "[url] - [code-200] - https://a.com/"},
+		{SpiderOutput{Source: "robots", OutputType: "url", Output: "https://a.com/admin"}, "[robots] - https://a.com/admin"},
+		{SpiderOutput{Source: "body", OutputType: "href", Output: "https://a.com/b"}, "[href] - https://a.com/b"},
+		{SpiderOutput{Source: "https://a.com/app.js", OutputType: "linkfinder", Output: "/api"}, "[linkfinder] - [from: https://a.com/app.js] - /api"},
+		{SpiderOutput{Source: "https://a.com/app.js", OutputType: "aws", Output: "https://b.s3.eu-west-3.amazonaws.com",
+			Cloud: &CloudAsset{Provider: ProviderS3, Bucket: "b", Region: "eu-west-3", URL: "https://b.s3.eu-west-3.amazonaws.com"}},
+			"[cloud] - [aws-s3] - [bucket: b] - [region: eu-west-3] - https://b.s3.eu-west-3.amazonaws.com"},
+		{SpiderOutput{Source: "https://a.com/app.js", OutputType: "cloud", Output: "https://storage.googleapis.com/b",
+			Cloud: &CloudAsset{Provider: ProviderGCS, Bucket: "b", URL: "https://storage.googleapis.com/b"}},
+			"[cloud] - [gcs] - [bucket: b] - https://storage.googleapis.com/b"},
+		{SpiderOutput{Source: "https://a.com/", OutputType: "technology", Output: "Nginx 1.18.0",
+			Technology: &Technology{Host: "a.com", Name: "Nginx", Version: "1.18.0", Categories: []string{"Web servers", "Reverse proxies"}}},
+			"[technology] - [a.com] - Nginx 1.18.0 - Web servers, Reverse proxies"},
+	}
+	for _, tt := range tests {
+		if got := tt.out.Text(false); got != tt.want {
+			t.Errorf("Text() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestTextSinkQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewTextSink(&buf, true, false)
+	sink.Write(SpiderOutput{Source: "body", OutputType: "href", Output: "https://a.com/b"})
+	sink.Write(SpiderOutput{Source: "body", OutputType: "url", StatusCode: 200, Output: "https://a.com/"})
+	if got := strings.TrimSpace(buf.String()); got != "https://a.com/" {
+		t.Errorf("quiet output = %q", got)
+	}
+}
+
+func TestChannelSink(t *testing.T) {
+	ch := make(chan SpiderOutput, 1)
+	NewChannelSink(ch).Write(SpiderOutput{OutputType: "form", Output: "https://a.com/login"})
+	if out := <-ch; out.Output != "https://a.com/login" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+}
@@ -1,48 +1,215 @@
 package core
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 
-	jsoniter "github.com/json-iterator/go"
-
 	"github.com/gocolly/colly/v2"
-	sitemap "github.com/oxffaa/gopher-parse-sitemap"
 )
 
+// DefaultSitemapDepth is how many levels of sitemap indexes are followed by default
+const DefaultSitemapDepth = 3
+
+var sitemapPaths = []string{"/sitemap.xml", "/sitemap_news.xml", "/sitemap_index.xml", "/sitemap-index.xml", "/sitemapindex.xml",
+	"/sitemap-news.xml", "/post-sitemap.xml", "/page-sitemap.xml", "/portfolio-sitemap.xml", "/home_slider-sitemap.xml", "/category-sitemap.xml",
+	"/author-sitemap.xml", "/sitemap.xml.gz", "/sitemap.txt"}
+
+// SitemapEntry is a <url> or <sitemap> element of a sitemap
+type SitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod"`
+	Priority string `xml:"priority"`
+}
+
 func ParseSiteMap(site *url.URL, crawler *Crawler, c *colly.Collector, wg *sync.WaitGroup) {
 	defer wg.Done()
-	sitemapUrls := []string{"/sitemap.xml", "/sitemap_news.xml", "/sitemap_index.xml", "/sitemap-index.xml", "/sitemapindex.xml",
-		"/sitemap-news.xml", "/post-sitemap.xml", "/page-sitemap.xml", "/portfolio-sitemap.xml", "/home_slider-sitemap.xml", "/category-sitemap.xml",
-		"/author-sitemap.xml"}
-
-	for _, path := range sitemapUrls {
-		// Ignore error when that not valid sitemap.xml path
-		Logger.Infof("Trying to find %s", site.String()+path)
-		_ = sitemap.ParseFromSite(site.String()+path, func(entry sitemap.Entry) error {
-			outputFormat := fmt.Sprintf("[sitemap] - %s", entry.GetLocation())
-
-			if crawler.JsonOutput {
-				sout := SpiderOutput{
-					Input:      crawler.Input,
-					Source:     "sitemap",
-					OutputType: "url",
-					Output:     entry.GetLocation(),
-				}
-				if data, err := jsoniter.MarshalToString(sout); err == nil {
-					outputFormat = data
-				}
-			} else if crawler.Quiet {
-				outputFormat = entry.GetLocation()
+
+	// Sitemaps declared in robots.txt come first, then the usual paths
+	sitemapUrls := ParseRobotsTxt(crawler.robotsTxt()).Sitemaps
+	for _, path := range sitemapPaths {
+		sitemapUrls = append(sitemapUrls, site.Scheme+"://"+site.Host+path)
+	}
+
+	depth := crawler.config.SitemapDepth
+	if depth <= 0 {
+		depth = DefaultSitemapDepth
+	}
+	seen := make(map[string]bool)
+	for _, sitemapURL := range sitemapUrls {
+		crawler.parseSitemap(sitemapURL, depth, seen, c)
+	}
+}
+
+// parseSitemap reports and crawls the URLs of a sitemap, following sitemap indexes up to depth levels
+func (crawler *Crawler) parseSitemap(sitemapURL string, depth int, seen map[string]bool, c *colly.Collector) {
+	if seen[sitemapURL] {
+		return
+	}
+	seen[sitemapURL] = true
+	if crawler.budget.Stopped() != "" {
+		return
+	}
+	if !crawler.scope.InScopeURL(sitemapURL) {
+		Logger.Debugf("Sitemap out of scope: %s", sitemapURL)
+		return
+	}
+
+	Logger.Infof("Trying to find %s", sitemapURL)
+	var sitemaps []SitemapEntry
+	err := crawler.fetchSitemap(sitemapURL, func(entry SitemapEntry, isIndex bool) {
+		if isIndex {
+			sitemaps = append(sitemaps, entry)
+			return
+		}
+		// A URL of several sitemaps, or also found in robots.txt or the pages, is reported once
+		if !crawler.urlSet.Duplicate(entry.Loc) {
+			crawler.emit(SpiderOutput{
+				Source:     "sitemap",
+				OutputType: "url",
+				Output:     entry.Loc,
+				LastMod:    entry.LastMod,
+				Priority:   entry.Priority,
+			})
+		}
+		if crawler.allowedURL(c, entry.Loc) {
+			_ = c.Visit(entry.Loc)
+		}
+	})
+	// Ignore error when that not valid sitemap path
+	if err != nil {
+		Logger.Debugf("No sitemap at %s: %s", sitemapURL, err)
+		return
+	}
+
+	for _, entry := range sitemaps {
+		if seen[entry.Loc] {
+			continue
+		}
+		crawler.emit(SpiderOutput{
+			Source:     "sitemap",
+			OutputType: "sitemap",
+			Output:     entry.Loc,
+			LastMod:    entry.LastMod,
+		})
+		if depth <= 1 {
+			Logger.Warnf("Sitemap depth limit reached, skipping %s", entry.Loc)
+			continue
+		}
+		crawler.parseSitemap(entry.Loc, depth-1, seen, c)
+	}
+}
+
+// fetchSitemap downloads a XML or text sitemap, gzipped or not, and calls fn for each of its entries.
+// isIndex tells whether the entry is another sitemap.
+func (crawler *Crawler) fetchSitemap(sitemapURL string, fn func(entry SitemapEntry, isIndex bool)) error {
+	resp, err := crawler.get(sitemapURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if magic, _ := body.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = bufio.NewReader(gz)
+	}
+
+	// Skip the byte order mark and the blank lines before guessing the format
+	if bom, _ := body.Peek(3); bytes.Equal(bom, []byte{0xef, 0xbb, 0xbf}) {
+		_, _ = body.Discard(3)
+	}
+	for {
+		b, err := body.Peek(1)
+		if err != nil {
+			return fmt.Errorf("empty sitemap")
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		_, _ = body.ReadByte()
+	}
+
+	if b, _ := body.Peek(1); len(b) == 1 && b[0] == '<' {
+		return parseXMLSitemap(body, fn)
+	}
+	return parseTextSitemap(body, fn)
+}
+
+// parseXMLSitemap streams the <url> and <sitemap> elements of a sitemap
+func parseXMLSitemap(r io.Reader, fn func(entry SitemapEntry, isIndex bool)) error {
+	decoder := xml.NewDecoder(r)
+	// Sitemaps are UTF-8, but some servers declare another charset
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	rootFound := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "urlset", "sitemapindex":
+			rootFound = true
+		case "url", "sitemap":
+			var entry SitemapEntry
+			if err := decoder.DecodeElement(&entry, &start); err != nil {
+				return err
 			}
-			fmt.Println(outputFormat)
-			if crawler.Output != nil {
-				crawler.Output.WriteToFile(outputFormat)
+			entry.Loc = strings.TrimSpace(entry.Loc)
+			entry.LastMod = strings.TrimSpace(entry.LastMod)
+			entry.Priority = strings.TrimSpace(entry.Priority)
+			if entry.Loc != "" {
+				fn(entry, start.Name.Local == "sitemap")
 			}
-			_ = c.Visit(entry.GetLocation())
-			return nil
-		})
+		}
 	}
+	if !rootFound {
+		return fmt.Errorf("not a sitemap")
+	}
+	return nil
+}
 
+// parseTextSitemap reads a sitemap with one URL per line
+func parseTextSitemap(r io.Reader, fn func(entry SitemapEntry, isIndex bool)) error {
+	sc := bufio.NewScanner(r)
+	found := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "http://") && !strings.HasPrefix(line, "https://") {
+			// Most likely an error page, not a sitemap
+			if !found {
+				return fmt.Errorf("not a sitemap")
+			}
+			continue
+		}
+		found = true
+		fn(SitemapEntry{Loc: line}, false)
+	}
+	return sc.Err()
 }
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseSiteMap(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /admin\nSitemap: %s/custom-index.xml\n", ts.URL)
+		case "/custom-index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/posts.xml.gz</loc><lastmod>2021-05-02</lastmod></sitemap>
+	<sitemap><loc>%[1]s/nested-index.xml</loc></sitemap>
+</sitemapindex>`, ts.URL)
+		case "/posts.xml.gz":
+			var gz bytes.Buffer
+			zw := gzip.NewWriter(&gz)
+			fmt.Fprintf(zw, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%s/gzipped</loc><lastmod>2021-05-01</lastmod><priority>0.8</priority></url>
+</urlset>`, ts.URL)
+			zw.Close()
+			w.Write(gz.Bytes())
+		case "/nested-index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/too-deep.xml</loc></sitemap></sitemapindex>`, ts.URL)
+		case "/too-deep.xml":
+			t.Error("sitemap depth limit not applied")
+		case "/sitemap.txt":
+			// Also listed in posts.xml.gz
+			fmt.Fprintf(w, "\n%[1]s/from-text\n%[1]s/gzipped\n", ts.URL)
+		case "/sitemap.xml":
+			// A soft 404 page must not be reported
+			fmt.Fprint(w, "<html><body>Not found</body></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 0
+	cfg.Robots = false
+	cfg.Sitemap = true
+	cfg.SitemapDepth = 2
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]SpiderOutput)
+	for out := range ch {
+		if out.Source != "sitemap" {
+			continue
+		}
+		if _, ok := found[out.Output]; ok {
+			t.Errorf("%s reported twice", out.Output)
+		}
+		found[out.Output] = out
+	}
+	want := map[string]SpiderOutput{
+		ts.URL + "/gzipped":          {OutputType: "url", LastMod: "2021-05-01", Priority: "0.8"},
+		ts.URL + "/from-text":        {OutputType: "url"},
+		ts.URL + "/posts.xml.gz":     {OutputType: "sitemap", LastMod: "2021-05-02"},
+		ts.URL + "/nested-index.xml": {OutputType: "sitemap"},
+		// Reported but not followed, it is past the depth limit
+		ts.URL + "/too-deep.xml": {OutputType: "sitemap"},
+	}
+	if len(found) != len(want) {
+		t.Errorf("got %d sitemap results, want %d: %v", len(found), len(want), found)
+	}
+	for u, w := range want {
+		got, ok := found[u]
+		if !ok {
+			t.Errorf("%s not found", u)
+			continue
+		}
+		if got.OutputType != w.OutputType || got.LastMod != w.LastMod || got.Priority != w.Priority {
+			t.Errorf("%s: got %+v, want %+v", u, got, w)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SourceClient is the HTTP client shared by the passive sources.
+// Rate limited and failed requests are retried with an exponential backoff.
+type SourceClient struct {
+	Client *http.Client
+	// Retries is the number of retries of a request after the first attempt
+	Retries int
+	// Backoff is the wait before the first retry, doubled on every retry.
+	// MaxBackoff caps it, and the Retry-After asked by the server.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*SourceStats
+}
+
+// SourceStats counts the requests sent to a passive source
+type SourceStats struct {
+	Requests int
+	Retries  int
+	// Failures are the requests still failing after every retry
+	Failures int
+}
+
+// NewSourceClient creates a client going through proxy
+func NewSourceClient(proxy string, timeout time.Duration) (*SourceClient, error) {
+	transport, err := NewTransport(&CrawlerConfig{Proxy: proxy})
+	if err != nil {
+		return nil, err
+	}
+	return newSourceClient(transport, timeout), nil
+}
+
+// newSourceClient creates a client sending its requests with transport
+func newSourceClient(transport http.RoundTripper, timeout time.Duration) *SourceClient {
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &SourceClient{
+		Client:     &http.Client{Transport: transport, Timeout: timeout},
+		Retries:    3,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+		stats:      make(map[string]*SourceStats),
+	}
+}
+
+// Get sends a GET request for source, it is canceled with ctx
+func (sc *SourceClient) Get(ctx context.Context, source, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sc.Do(source, req)
+}
+
+// GetJSON sends a GET request for source and decodes its JSON answer into v
+func (sc *SourceClient) GetJSON(ctx context.Context, source, rawURL string, v interface{}) error {
+	resp, err := sc.Get(ctx, source, rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON answer: %s", err)
+	}
+	return nil
+}
+
+// Do sends a request for source, retrying on network errors, 429 and 5xx answers.
+// Other answers are returned as is, whatever their status. The retries stop when the request is canceled.
+func (sc *SourceClient) Do(source string, req *http.Request) (*http.Response, error) {
+	stats := sc.sourceStats(source)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := sc.Client.Do(req)
+		if urlErr, ok := err.(*url.Error); ok {
+			// The URL is added back below without its query, which may hold an API key
+			err = urlErr.Err
+		}
+		sc.mu.Lock()
+		stats.Requests++
+		sc.mu.Unlock()
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			if err == nil {
+				resp.Body.Close()
+			}
+			return nil, ctxErr
+		}
+
+		wait := sc.backoff(attempt)
+		if err == nil {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+				if sc.MaxBackoff > 0 && wait > sc.MaxBackoff {
+					wait = sc.MaxBackoff
+				}
+			}
+			resp.Body.Close()
+		}
+
+		if attempt >= sc.Retries {
+			sc.mu.Lock()
+			stats.Failures++
+			sc.mu.Unlock()
+			return nil, fmt.Errorf("%s://%s%s: %s", req.URL.Scheme, req.URL.Host, req.URL.Path, err)
+		}
+
+		sc.mu.Lock()
+		stats.Retries++
+		sc.mu.Unlock()
+		Logger.Debugf("%s: %s, retrying in %s", source, err, wait)
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// Stats returns the request counts of a source
+func (sc *SourceClient) Stats(source string) SourceStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if stats, ok := sc.stats[source]; ok {
+		return *stats
+	}
+	return SourceStats{}
+}
+
+func (sc *SourceClient) sourceStats(source string) *SourceStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.stats == nil {
+		sc.stats = make(map[string]*SourceStats)
+	}
+	stats, ok := sc.stats[source]
+	if !ok {
+		stats = &SourceStats{}
+		sc.stats[source] = stats
+	}
+	return stats
+}
+
+func (sc *SourceClient) backoff(attempt int) time.Duration {
+	wait := sc.Backoff << uint(attempt)
+	if sc.MaxBackoff > 0 && (wait > sc.MaxBackoff || wait <= 0) {
+		wait = sc.MaxBackoff
+	}
+	return wait
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as a HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
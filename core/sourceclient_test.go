@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSourceClient(t *testing.T) *SourceClient {
+	client, err := NewSourceClient("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Backoff = time.Millisecond
+	return client
+}
+
+func TestSourceClientRetry(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mu.Unlock()
+		switch attempt {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	client := newTestSourceClient(t)
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader("domain=example.com"))
+	resp, err := client.Do("test", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d", resp.StatusCode)
+	}
+	for _, body := range bodies {
+		if body != "domain=example.com" {
+			t.Errorf("retried request lost its body: %q", body)
+		}
+	}
+	if stats := client.Stats("test"); stats != (SourceStats{Requests: 3, Retries: 2}) {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestSourceClientGivesUp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client := newTestSourceClient(t)
+	if _, err := client.Get(context.Background(), "test", ts.URL+"/?apikey=secret"); err == nil {
+		t.Fatal("expected an error")
+	} else if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error leaks the query: %s", err)
+	}
+	if stats := client.Stats("test"); stats != (SourceStats{Requests: 4, Retries: 3, Failures: 1}) {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	// Other errors are left to the providers
+	var notFound int
+	ts404 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFound++
+		http.NotFound(w, r)
+	}))
+	defer ts404.Close()
+	resp, err := client.Get(context.Background(), "test404", ts404.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || notFound != 1 {
+		t.Errorf("got status %d after %d requests", resp.StatusCode, notFound)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("120"); !ok || wait != 2*time.Minute {
+		t.Errorf("seconds: got %s, %v", wait, ok)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if wait, ok := parseRetryAfter(date); !ok || wait < 59*time.Minute || wait > time.Hour {
+		t.Errorf("date: got %s, %v", wait, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("invalid value accepted")
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceMap is a JavaScript source map, only the fields needed to recover the original sources are read
+type SourceMap struct {
+	Version    int      `json:"version"`
+	File       string   `json:"file"`
+	SourceRoot string   `json:"sourceRoot"`
+	Sources    []string `json:"sources"`
+	// SourcesContent holds the original sources, null for the ones not embedded in the map
+	SourcesContent []*string `json:"sourcesContent"`
+}
+
+// OriginalSource is a source file recovered from a source map
+type OriginalSource struct {
+	Path    string
+	Content string
+}
+
+var sourceMappingURLRegex = regexp.MustCompile(`[#@]\s*sourceMappingURL=\s*([^\s'"*]+)`)
+
+// ParseSourceMap parses a version 3 source map
+func ParseSourceMap(data []byte) (*SourceMap, error) {
+	var sm SourceMap
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil, fmt.Errorf("invalid source map: %s", err)
+	}
+	if sm.Version != 3 || len(sm.Sources) == 0 {
+		return nil, fmt.Errorf("invalid source map: version %d with %d sources", sm.Version, len(sm.Sources))
+	}
+	return &sm, nil
+}
+
+// Originals returns the sources embedded in the map, with their path in the map
+func (sm *SourceMap) Originals() []OriginalSource {
+	var originals []OriginalSource
+	for i, source := range sm.Sources {
+		if i >= len(sm.SourcesContent) || sm.SourcesContent[i] == nil {
+			continue
+		}
+		if sm.SourceRoot != "" && !strings.Contains(source, "://") {
+			source = strings.TrimSuffix(sm.SourceRoot, "/") + "/" + strings.TrimPrefix(source, "/")
+		}
+		originals = append(originals, OriginalSource{Path: source, Content: *sm.SourcesContent[i]})
+	}
+	return originals
+}
+
+// SourceMappingURL returns the source map of a script, from its SourceMap or X-SourceMap headers
+// or its last sourceMappingURL comment, empty when there is none
+func SourceMappingURL(body []byte, header http.Header) string {
+	for _, name := range []string{"SourceMap", "X-SourceMap"} {
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			return value
+		}
+	}
+	// The comment is the last one of the script, inlined maps make it long
+	i := bytes.LastIndex(body, []byte("sourceMappingURL="))
+	if i < 0 {
+		return ""
+	}
+	start := i - 8
+	if start < 0 {
+		start = 0
+	}
+	m := sourceMappingURLRegex.FindSubmatch(body[start:])
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
+
+// decodeDataSourceMap returns the content of a source map inlined as a data: URL
+func decodeDataSourceMap(dataURL string) ([]byte, error) {
+	comma := strings.Index(dataURL, ",")
+	if !strings.HasPrefix(dataURL, "data:") || comma < 0 {
+		return nil, fmt.Errorf("invalid data URL")
+	}
+	meta, data := dataURL[len("data:"):comma], dataURL[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	decoded, err := url.PathUnescape(data)
+	return []byte(decoded), err
+}
+
+// SourcePath turns the path of an original source into a relative file path,
+// webpack:///./src/app.js becomes src/app.js. It is empty for the paths naming no file.
+func SourcePath(source string) string {
+	if i := strings.Index(source, "://"); i >= 0 {
+		source = source[i+3:]
+	}
+	if i := strings.IndexAny(source, "?#"); i >= 0 {
+		source = source[:i]
+	}
+	// Cleaning a rooted path removes the .. escaping the output folder
+	p := strings.TrimPrefix(path.Clean("/"+source), "/")
+	if p == "" || p == "." || strings.HasSuffix(source, "/") {
+		return ""
+	}
+	return p
+}
+
+// SourceMapFolder returns the folder of the sources of a map inside the sources folder,
+// https://example.com:8443/static/app.js.map becomes example.com_8443/static/app.js.map.
+// The maps of a site often share the paths of their sources, like src/index.js.
+func SourceMapFolder(mapURL *url.URL) string {
+	return path.Join(strings.ReplaceAll(mapURL.Host, ":", "_"), SourcePath(mapURL.Path))
+}
+
+// isVendorSource tells the third party sources, which are recovered but not analyzed
+func isVendorSource(source string) bool {
+	return strings.Contains(source, "node_modules/") || strings.Contains(source, "webpack/bootstrap")
+}
+
+// looksLikeSourceMap avoids parsing every JSON file as a source map
+func looksLikeSourceMap(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return bytes.HasPrefix(body, []byte("{")) && bytes.Contains(body, []byte(`"mappings"`))
+}
+
+// findSourceMap feeds the source map of a script to the link finder, the inlined ones are analyzed at once
+func (crawler *Crawler) findSourceMap(body []byte, header http.Header, scriptURL *url.URL) {
+	mapURL := SourceMappingURL(body, header)
+	if mapURL == "" {
+		return
+	}
+	if strings.HasPrefix(mapURL, "data:") {
+		data, err := decodeDataSourceMap(mapURL)
+		if err != nil {
+			Logger.Debugf("Invalid inline source map in %s: %s", scriptURL, err)
+			return
+		}
+		if sm, err := ParseSourceMap(data); err == nil {
+			crawler.recoverSources(sm, scriptURL)
+		}
+		return
+	}
+	if u := FixUrl(scriptURL, mapURL); u != "" {
+		crawler.feedLinkfinder(u, "sourcemap", scriptURL.String())
+	}
+}
+
+// recoverSources writes the original sources of a map to its folder in the output folder, reports their paths
+// and runs the endpoint extraction over the ones of the site
+func (crawler *Crawler) recoverSources(sm *SourceMap, mapURL *url.URL) {
+	for _, original := range sm.Originals() {
+		crawler.emit(SpiderOutput{
+			Source:     mapURL.String(),
+			OutputType: "source",
+			Output:     original.Path,
+		})
+		if crawler.output != nil {
+			if p := SourcePath(original.Path); p != "" {
+				p = path.Join(SourceMapFolder(mapURL), p)
+				if err := crawler.output.WriteSource(p, original.Content); err != nil {
+					Logger.Errorf("Failed to write source %s: %s", p, err)
+				}
+			}
+		}
+		if !isVendorSource(original.Path) {
+			crawler.analyzeJS(original.Content, mapURL)
+		}
+	}
+}
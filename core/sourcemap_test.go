@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sourceMapFixture = `{
+	"version": 3,
+	"file": "app.js",
+	"sources": ["webpack:///./src/api.js", "webpack:///./node_modules/lib/index.js", "webpack:///../../etc/passwd", "webpack:///./src/missing.js"],
+	"sourcesContent": ["export const save = (id) => fetch('/api/v1/items/' + id, {method: 'PUT'});", "fetch('/vendor/endpoint');", "root", null],
+	"mappings": "AAAA"
+}`
+
+func TestParseSourceMap(t *testing.T) {
+	sm, err := ParseSourceMap([]byte(sourceMapFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	originals := sm.Originals()
+	if len(originals) != 3 || originals[0].Path != "webpack:///./src/api.js" {
+		t.Errorf("unexpected original sources %v", originals)
+	}
+	if _, err := ParseSourceMap([]byte(`{"version": 2, "sources": ["a.js"]}`)); err == nil {
+		t.Error("expected an error for a version 2 map")
+	}
+}
+
+func TestSourceMappingURL(t *testing.T) {
+	inline := "data:application/json;base64," + base64.StdEncoding.EncodeToString([]byte(sourceMapFixture))
+	tests := []struct {
+		body   string
+		header http.Header
+		want   string
+	}{
+		{"var a = 1;\n//# sourceMappingURL=app.js.map\n", nil, "app.js.map"},
+		{"var a = 1;\n//@ sourceMappingURL=/maps/old.map", nil, "/maps/old.map"},
+		{"body{}\n/*# sourceMappingURL=style.css.map */", nil, "style.css.map"},
+		{"var a = 1;", http.Header{"Sourcemap": {"/maps/app.js.map"}}, "/maps/app.js.map"},
+		{"var a = 1;", http.Header{"X-Sourcemap": {"app.map"}}, "app.map"},
+		{"var a = 1;\n//# sourceMappingURL=" + inline, nil, inline},
+		{"var a = 1;", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := SourceMappingURL([]byte(tt.body), tt.header); got != tt.want {
+			t.Errorf("SourceMappingURL(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	data, err := decodeDataSourceMap(inline)
+	if err != nil || string(data) != sourceMapFixture {
+		t.Errorf("failed to decode the inline map: %v", err)
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	tests := map[string]string{
+		"webpack:///./src/app.js":      "src/app.js",
+		"webpack://my-app/./src/a.ts":  "my-app/src/a.ts",
+		"../../../etc/passwd":          "etc/passwd",
+		"src/app.vue?vue&type=script":  "src/app.vue",
+		"webpack:///webpack/bootstrap": "webpack/bootstrap",
+		"webpack:///./src/":            "",
+		"":                             "",
+	}
+	for source, want := range tests {
+		if got := SourcePath(source); got != want {
+			t.Errorf("SourcePath(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
+
+func TestSourceMapFolder(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/static/app.js.map":     "example.com/static/app.js.map",
+		"https://example.com:8443/app.js.map?v=2":   "example.com_8443/app.js.map",
+		"https://example.com/../../static/a.js.map": "example.com/static/a.js.map",
+		"https://cdn.example.com/":                  "cdn.example.com",
+	}
+	for rawURL, want := range tests {
+		u, _ := url.Parse(rawURL)
+		if got := SourceMapFolder(u); got != want {
+			t.Errorf("SourceMapFolder(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestCrawlerSourceMaps(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = w.Write([]byte(`<html><script src="/static/app.js"></script><script src="/admin/app.js"></script></html>`))
+		case "/static/app.js":
+			_, _ = w.Write([]byte("var a=1;\n//# sourceMappingURL=app.js.map\n"))
+		case "/static/app.js.map":
+			_, _ = w.Write([]byte(sourceMapFixture))
+		case "/admin/app.js":
+			_, _ = w.Write([]byte("var b=1;\n//# sourceMappingURL=app.js.map\n"))
+		case "/admin/app.js.map":
+			_, _ = w.Write([]byte(`{"version": 3, "sources": ["webpack:///./src/api.js"], "sourcesContent": ["admin"], "mappings": "AAAA"}`))
+		}
+	}))
+	defer ts.Close()
+
+	site, _ := url.Parse(ts.URL)
+	folder := t.TempDir()
+	ch := make(chan SpiderOutput, 100)
+	cfg := NewCrawlerConfig()
+	cfg.MaxDepth = 3
+	cfg.Robots = false
+	cfg.OutputFolder = folder
+	cfg.Sinks = []ResultSink{NewChannelSink(ch)}
+	crawler, err := NewCrawler(site, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawler.Run()
+	close(ch)
+
+	found := make(map[string]map[string]string)
+	for out := range ch {
+		if found[out.OutputType] == nil {
+			found[out.OutputType] = make(map[string]string)
+		}
+		found[out.OutputType][out.Output] = out.Method
+	}
+	if _, ok := found["sourcemap"][ts.URL+"/static/app.js.map"]; !ok {
+		t.Errorf("source map not reported: %v", found["sourcemap"])
+	}
+	if len(found["source"]) != 3 {
+		t.Errorf("unexpected sources %v", found["source"])
+	}
+	if found["linkfinder"]["/api/v1/items/{id}"] != "PUT" {
+		t.Errorf("endpoint of the original source not found: %v", found["linkfinder"])
+	}
+	if _, ok := found["linkfinder"]["/vendor/endpoint"]; ok {
+		t.Error("vendor source analyzed")
+	}
+
+	// The maps sharing the paths of their sources don't overwrite each other
+	sources := filepath.Join(folder, site.Hostname(), "sources", strings.ReplaceAll(site.Host, ":", "_"))
+	content, err := ioutil.ReadFile(filepath.Join(sources, "static", "app.js.map", "src", "api.js"))
+	if err != nil || string(content) != "export const save = (id) => fetch('/api/v1/items/' + id, {method: 'PUT'});" {
+		t.Errorf("source not recovered: %v", err)
+	}
+	content, err = ioutil.ReadFile(filepath.Join(sources, "admin", "app.js.map", "src", "api.js"))
+	if err != nil || string(content) != "admin" {
+		t.Errorf("source of the second map not recovered: %v", err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(sources, "static", "app.js.map", "etc", "passwd")); err != nil {
+		t.Errorf("escaping source not written inside the sources folder: %v", err)
+	}
+}
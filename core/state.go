@@ -0,0 +1,386 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/gocolly/colly/v2/storage"
+	"github.com/jaeles-project/gospider/stringset"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	frontierBucket = []byte("frontier")
+	visitedBucket  = []byte("visited")
+)
+
+// State persists the progress of a crawl on disk so that a killed run can be resumed.
+// It stores the pending URL frontier, the visited requests of the collectors and
+// the content of the dedupe sets.
+// State implements colly's storage.Storage, cookies are kept in memory.
+//
+// The writes are queued and batched in the transactions of a single writer,
+// the requests of the collectors don't wait for them.
+type State struct {
+	db      *bolt.DB
+	cookies *storage.InMemoryStorage
+
+	// visited are the requests visited during this run, their writes may still be queued
+	visitedMu sync.Mutex
+	visited   map[uint64]bool
+
+	// mu guards the writes queue, which is closed by Close
+	mu     sync.RWMutex
+	closed bool
+	writes chan stateWrite
+	done   chan struct{}
+}
+
+// stateWrite puts a key in a bucket, or deletes it when value is nil.
+// A write with flushed set only tells the writer to close it once the previous writes are saved.
+type stateWrite struct {
+	bucket  []byte
+	key     []byte
+	value   []byte
+	flushed chan struct{}
+}
+
+// maxStateBatch is the max number of writes of a transaction
+const maxStateBatch = 1000
+
+// OpenState opens the state file of a site inside folder.
+// When resume is false, any previous state of the site is discarded.
+func OpenState(folder string, site *url.URL, resume bool) (*State, error) {
+	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create state folder: %s", err)
+	}
+	stateFile := filepath.Join(folder, strings.ReplaceAll(site.Host, ":", "_")+".db")
+	if !resume {
+		if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to reset state: %s", err)
+		}
+	}
+
+	db, err := bolt.Open(stateFile, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state %s: %s", stateFile, err)
+	}
+	// Writes only need to survive the process being killed, not a power loss
+	db.NoSync = true
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{frontierBucket, visitedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &State{
+		db:      db,
+		cookies: &storage.InMemoryStorage{},
+		visited: make(map[uint64]bool),
+		writes:  make(chan stateWrite, maxStateBatch),
+		done:    make(chan struct{}),
+	}
+	go s.writeLoop()
+	return s, nil
+}
+
+// write queues a write, the writes after Close are dropped
+func (s *State) write(w stateWrite) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		if w.flushed != nil {
+			close(w.flushed)
+		}
+		return
+	}
+	s.writes <- w
+}
+
+// flush waits for the queued writes to be saved
+func (s *State) flush() {
+	flushed := make(chan struct{})
+	s.write(stateWrite{flushed: flushed})
+	<-flushed
+}
+
+// writeLoop saves the queued writes, all the writes waiting are saved in the same transaction
+func (s *State) writeLoop() {
+	defer close(s.done)
+	for w := range s.writes {
+		batch := []stateWrite{w}
+	queued:
+		for len(batch) < maxStateBatch {
+			select {
+			case w, ok := <-s.writes:
+				if !ok {
+					break queued
+				}
+				batch = append(batch, w)
+			default:
+				break queued
+			}
+		}
+
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			for _, w := range batch {
+				if w.flushed != nil {
+					continue
+				}
+				b := tx.Bucket(w.bucket)
+				if w.value == nil {
+					if err := b.Delete(w.key); err != nil {
+						return err
+					}
+				} else if err := b.Put(w.key, w.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			Logger.Errorf("Failed to save state: %s", err)
+		}
+		for _, w := range batch {
+			if w.flushed != nil {
+				close(w.flushed)
+			}
+		}
+	}
+}
+
+// Init implements storage.Storage
+func (s *State) Init() error {
+	return s.cookies.Init()
+}
+
+// Visited implements storage.Storage
+func (s *State) Visited(requestID uint64) error {
+	s.visitedMu.Lock()
+	s.visited[requestID] = true
+	s.visitedMu.Unlock()
+	s.write(stateWrite{bucket: visitedBucket, key: requestKey(requestID), value: []byte{}})
+	return nil
+}
+
+// IsVisited implements storage.Storage
+func (s *State) IsVisited(requestID uint64) (bool, error) {
+	s.visitedMu.Lock()
+	visited := s.visited[requestID]
+	s.visitedMu.Unlock()
+	if visited {
+		return true, nil
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		visited = tx.Bucket(visitedBucket).Get(requestKey(requestID)) != nil
+		return nil
+	})
+	return visited, err
+}
+
+// Cookies implements storage.Storage
+func (s *State) Cookies(u *url.URL) string {
+	return s.cookies.Cookies(u)
+}
+
+// SetCookies implements storage.Storage
+func (s *State) SetCookies(u *url.URL, cookies string) {
+	s.cookies.SetCookies(u, cookies)
+}
+
+// frontierEntry is a request that was started but not finished yet
+type frontierEntry struct {
+	URL       string
+	Collector string
+	Depth     int
+}
+
+// AddFrontier records a pending request of a collector
+func (s *State) AddFrontier(u, collector string, depth int) {
+	s.write(stateWrite{bucket: frontierBucket, key: []byte(u), value: []byte(collector + "|" + strconv.Itoa(depth))})
+}
+
+// DoneFrontier removes a finished request from the frontier
+func (s *State) DoneFrontier(u string) {
+	s.write(stateWrite{bucket: frontierBucket, key: []byte(u)})
+}
+
+// Frontier returns every pending request and marks them as not visited,
+// so the collectors accept them again.
+func (s *State) Frontier() ([]frontierEntry, error) {
+	s.flush()
+	var entries []frontierEntry
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		visited := tx.Bucket(visitedBucket)
+		return tx.Bucket(frontierBucket).ForEach(func(k, v []byte) error {
+			args := strings.SplitN(string(v), "|", 2)
+			depth := 1
+			if len(args) == 2 {
+				depth, _ = strconv.Atoi(args[1])
+			}
+			entries = append(entries, frontierEntry{URL: string(k), Collector: args[0], Depth: depth})
+			requestID := getRequestID(string(k))
+			s.visitedMu.Lock()
+			delete(s.visited, requestID)
+			s.visitedMu.Unlock()
+			return visited.Delete(requestKey(requestID))
+		})
+	})
+	return entries, err
+}
+
+// Filter returns a dedupe filter backed by the bucket name, loaded with its saved content
+func (s *State) Filter(name string) (*stateFilter, error) {
+	return s.filter(name, stringset.NewStringFilter())
+}
+
+// ExactFilter is Filter keeping the case of the strings
+func (s *State) ExactFilter(name string) (*stateFilter, error) {
+	return s.filter(name, &exactFilter{})
+}
+
+func (s *State) filter(name string, filter stringFilter) (*stateFilter, error) {
+	f := &stateFilter{stringFilter: filter, state: s, bucket: []byte("set-" + name)}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(f.bucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			f.stringFilter.Duplicate(string(k))
+			return nil
+		})
+	})
+	return f, err
+}
+
+func (s *State) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.writes)
+	s.mu.Unlock()
+	<-s.done
+
+	if err := s.db.Sync(); err != nil {
+		Logger.Errorf("Failed to sync state: %s", err)
+	}
+	return s.db.Close()
+}
+
+// stateFilter is a stringFilter that also saves new strings in the state
+type stateFilter struct {
+	stringFilter
+	state  *State
+	bucket []byte
+}
+
+func (f *stateFilter) Duplicate(s string) bool {
+	if f.stringFilter.Duplicate(s) {
+		return true
+	}
+	f.state.write(stateWrite{bucket: f.bucket, key: []byte(s), value: []byte{}})
+	return false
+}
+
+// setupState tracks the frontier of the collectors in the crawler state
+func (crawler *Crawler) setupState() {
+	// Frontier URLs by request, the URL of a request changes when it is redirected
+	var pending sync.Map
+
+	track := func(c *colly.Collector, name string) {
+		c.OnRequest(func(r *colly.Request) {
+			// Restore the depth of a resumed request.
+			// The context is shared with the child requests so it must only be used once
+			if depth, ok := r.Ctx.GetAny("resumeDepth").(int); ok {
+				r.Depth = depth
+				r.Ctx.Put("resumeDepth", nil)
+			}
+			if r.Method != "GET" || !crawler.inScope(c, r.URL) {
+				return
+			}
+			u := r.URL.String()
+			crawler.state.AddFrontier(u, name, r.Depth)
+			// The requests aborted once the budget is spent stay in the frontier to be resumed,
+			// they are not pending as they never end
+			if crawler.budget.Stopped() == "" {
+				pending.Store(r, u)
+			}
+		})
+		done := func(r *colly.Request) {
+			if u, ok := pending.Load(r); ok {
+				pending.Delete(r)
+				crawler.state.DoneFrontier(u.(string))
+			}
+		}
+		c.OnScraped(func(response *colly.Response) {
+			done(response.Request)
+		})
+		c.OnError(func(response *colly.Response, err error) {
+			// Requests dropped by the budget stay in the frontier to be resumed
+			if errors.Is(err, ErrBudgetSpent) {
+				pending.Delete(response.Request)
+				return
+			}
+			done(response.Request)
+		})
+	}
+	track(crawler.C, "main")
+	track(crawler.LinkFinderCollector, "linkfinder")
+}
+
+// resumeFrontier requests again every URL pending in the saved state
+func (crawler *Crawler) resumeFrontier() {
+	entries, err := crawler.state.Frontier()
+	if err != nil {
+		Logger.Errorf("Failed to load frontier: %s", err)
+		return
+	}
+	Logger.Infof("Resuming %d pending URLs of %s", len(entries), crawler.site)
+	for _, e := range entries {
+		c := crawler.C
+		if e.Collector == "linkfinder" {
+			c = crawler.LinkFinderCollector
+		}
+		if !crawler.allowedURL(c, e.URL) {
+			continue
+		}
+		ctx := colly.NewContext()
+		ctx.Put("resumeDepth", e.Depth)
+		if err := c.Request("GET", e.URL, nil, ctx, nil); err != nil {
+			Logger.Debugf("Failed to resume %s: %s", e.URL, err)
+		}
+	}
+}
+
+// getRequestID returns the ID colly uses to mark a GET request as visited
+func getRequestID(u string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(u))
+	return h.Sum64()
+}
+
+func requestKey(requestID uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, requestID)
+	return key
+}
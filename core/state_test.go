@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestStateResume(t *testing.T) {
+	folder := t.TempDir()
+	site, _ := url.Parse("https://example.com")
+	pending := "https://example.com/pending"
+
+	state, err := OpenState(folder, site, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = state.Visited(getRequestID(pending))
+	_ = state.Visited(getRequestID("https://example.com/done"))
+	state.AddFrontier(pending, "main", 2)
+	state.AddFrontier("https://example.com/done", "main", 1)
+	state.DoneFrontier("https://example.com/done")
+	jsSet, _ := state.Filter("js")
+	jsSet.Duplicate("https://example.com/app.js")
+	_ = state.Close()
+
+	state, err = OpenState(folder, site, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	entries, err := state.Frontier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0] != (frontierEntry{URL: pending, Collector: "main", Depth: 2}) {
+		t.Fatalf("unexpected frontier: %+v", entries)
+	}
+	if visited, _ := state.IsVisited(getRequestID(pending)); visited {
+		t.Error("pending URL should not be visited anymore")
+	}
+	if visited, _ := state.IsVisited(getRequestID("https://example.com/done")); !visited {
+		t.Error("finished URL should stay visited")
+	}
+	jsSet, _ = state.Filter("js")
+	if !jsSet.Duplicate("https://example.com/app.js") {
+		t.Error("js set was not restored")
+	}
+}
+
+func TestResumeTwice(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/pending">pending</a>`)
+		}
+	}))
+	defer ts.Close()
+	site, _ := url.Parse(ts.URL)
+	folder := t.TempDir()
+
+	// A killed crawl left /pending visited but not done
+	state, err := OpenState(folder, site, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = state.Visited(getRequestID(ts.URL + "/pending"))
+	state.AddFrontier(ts.URL+"/pending", "main", 1)
+	_ = state.Close()
+
+	for i := 0; i < 2; i++ {
+		cfg := NewCrawlerConfig()
+		cfg.Robots = false
+		cfg.StateDir = folder
+		cfg.Resume = true
+		cfg.Sinks = []ResultSink{NewChannelSink(make(chan SpiderOutput, 100))}
+		crawler, err := NewCrawler(site, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crawler.Run()
+	}
+	// The first resume crawls the frontier, the second one has nothing left to do
+	if requests["/pending"] != 1 || requests["/"] != 1 {
+		t.Errorf("unexpected requests %v", requests)
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CrawlSummary describes a finished crawl
+type CrawlSummary struct {
+	// Pages are the responses received, Errors the failed requests
+	Pages    int
+	Errors   int
+	Requests int
+	Bytes    int64
+	Duration time.Duration
+	// Found counts the findings by result type
+	Found map[string]int
+	// StopReason is why the crawl stopped before the end, empty when it ran to completion
+	StopReason string
+	// CappedHosts are the hosts which spent their request budget
+	CappedHosts []string
+	// Sources are the outcomes of the 3rd party sources, when used
+	Sources []SourceSummary
+}
+
+// SourceSummary is the outcome of a 3rd party source
+type SourceSummary struct {
+	Name string
+	URLs int
+	SourceStats
+	// Err is why the source failed, empty when it succeeded
+	Err string
+}
+
+func (s SourceSummary) String() string {
+	status := "ok"
+	if s.Err != "" {
+		status = "failed"
+	}
+	return fmt.Sprintf("%s %s, %d URLs, %d requests, %d retries, %d failed requests",
+		s.Name, status, s.URLs, s.Requests, s.Retries, s.Failures)
+}
+
+func (s CrawlSummary) String() string {
+	out := fmt.Sprintf("%d pages, %d requests, %d errors, %d bytes in %s",
+		s.Pages, s.Requests, s.Errors, s.Bytes, s.Duration.Round(time.Millisecond))
+	if len(s.Found) > 0 {
+		var types []string
+		for outputType := range s.Found {
+			types = append(types, outputType)
+		}
+		sort.Strings(types)
+		var found []string
+		for _, outputType := range types {
+			found = append(found, fmt.Sprintf("%d %s", s.Found[outputType], outputType))
+		}
+		out += ", found " + strings.Join(found, ", ")
+	}
+	if s.StopReason != "" {
+		out += ", stopped early: " + s.StopReason
+	}
+	if len(s.CappedHosts) > 0 {
+		out += fmt.Sprintf(", request budget spent for %v", s.CappedHosts)
+	}
+	if len(s.Sources) > 0 {
+		var sources []string
+		for _, source := range s.Sources {
+			sources = append(sources, source.String())
+		}
+		out += ", sources: " + strings.Join(sources, "; ")
+	}
+	return out
+}
+
+// crawlStats counts the pages, errors and findings of a crawl for its summary
+type crawlStats struct {
+	mu      sync.Mutex
+	pages   int
+	errors  int
+	found   map[string]int
+	sources []SourceSummary
+}
+
+func (s *crawlStats) page() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages++
+}
+
+func (s *crawlStats) failure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+}
+
+func (s *crawlStats) finding(outputType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.found == nil {
+		s.found = make(map[string]int)
+	}
+	s.found[outputType]++
+}
+
+func (s *crawlStats) source(source SourceSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = append(s.sources, source)
+}
+
+// fill adds the counts to a summary
+func (s *crawlStats) fill(summary *CrawlSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary.Pages = s.pages
+	summary.Errors = s.errors
+	summary.Found = make(map[string]int, len(s.found))
+	for outputType, n := range s.found {
+		summary.Found[outputType] = n
+	}
+	summary.Sources = append([]SourceSummary(nil), s.sources...)
+}
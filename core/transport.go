@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// Proxy rotations
+const (
+	// ProxyRoundRobin sends each request through the next proxy
+	ProxyRoundRobin = "round-robin"
+	// ProxyPerHost sends all the requests to a host through the same proxy
+	ProxyPerHost = "host"
+)
+
+// NewTransport returns a transport of its own for a crawler, a clone of DefaultHTTPTransport
+// going through the proxies of cfg.
+func NewTransport(cfg *CrawlerConfig) (*http.Transport, error) {
+	transport := DefaultHTTPTransport.Clone()
+	proxies, err := parseProxies(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(proxies) == 0:
+		// The proxy of DefaultHTTPTransport, if any, is kept
+	case len(proxies) == 1:
+		transport.Proxy = http.ProxyURL(proxies[0])
+	case cfg.ProxyRotation == ProxyPerHost:
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(req.URL.Hostname()))
+			return proxies[h.Sum32()%uint32(len(proxies))], nil
+		}
+	case cfg.ProxyRotation == "" || cfg.ProxyRotation == ProxyRoundRobin:
+		var next uint32
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			i := atomic.AddUint32(&next, 1) - 1
+			return proxies[i%uint32(len(proxies))], nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown proxy rotation %q, expected %s or %s", cfg.ProxyRotation, ProxyRoundRobin, ProxyPerHost)
+	}
+	return transport, nil
+}
+
+// parseProxies returns Proxy and Proxies, with ProxyAuth added to the ones without credentials
+func parseProxies(cfg *CrawlerConfig) ([]*url.URL, error) {
+	var rawProxies []string
+	if cfg.Proxy != "" {
+		rawProxies = append(rawProxies, cfg.Proxy)
+	}
+	rawProxies = append(rawProxies, cfg.Proxies...)
+
+	var proxies []*url.URL
+	for _, rawProxy := range rawProxies {
+		rawProxy = strings.TrimSpace(rawProxy)
+		if rawProxy == "" {
+			continue
+		}
+		u, err := url.Parse(rawProxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %s, expected a URL like http://127.0.0.1:8080 or socks5://127.0.0.1:9050", rawProxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy %s: unsupported scheme %s", rawProxy, u.Scheme)
+		}
+		if u.User == nil && cfg.ProxyAuth != "" {
+			auth := strings.SplitN(cfg.ProxyAuth, ":", 2)
+			if len(auth) == 2 {
+				u.User = url.UserPassword(auth[0], auth[1])
+			} else {
+				u.User = url.User(auth[0])
+			}
+		}
+		proxies = append(proxies, u)
+	}
+	return proxies, nil
+}
+
+// renderProxy is the proxy of the headless browser, which can't rotate proxies:
+// Proxy or the first of Proxies, with the ProxyAuth credentials
+func renderProxy(cfg *CrawlerConfig) string {
+	proxies, err := parseProxies(cfg)
+	if err != nil || len(proxies) == 0 {
+		return ""
+	}
+	return proxies[0].String()
+}
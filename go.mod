@@ -3,15 +3,20 @@ module github.com/jaeles-project/gospider
 go 1.16
 
 require (
+	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/chromedp/cdproto v0.0.0-20211126220118-81fa0469ad77
+	github.com/chromedp/chromedp v0.7.6
 	github.com/gocolly/colly/v2 v2.1.0
 	github.com/json-iterator/go v1.1.11
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/onsi/ginkgo v1.16.4 // indirect
 	github.com/onsi/gomega v1.13.0 // indirect
-	github.com/oxffaa/gopher-parse-sitemap v0.0.0-20191021113419-005d2eb1def4
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.1.3
+	github.com/tdewolff/parse/v2 v2.7.12
 	github.com/x-cray/logrus-prefixed-formatter v0.5.2
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
+	gopkg.in/yaml.v2 v2.4.0
 )